@@ -0,0 +1,123 @@
+package plugin
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// One component of a sexagesimal value, the sign is taken off the value as a whole
+var SEXAGESIMAL_COMPONENT = regexp.MustCompile(`^[0-9]+(\.[0-9]*)?$`)
+
+// parseSexagesimal converts a sexagesimal string such as "12:34:56.7", "-00:30:00", "12 34 56.7" or "45d12m03s"
+// to a decimal value in the same units as the leading component.  A plain decimal number is accepted as is.
+func parseSexagesimal(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty value")
+	}
+
+	// Pull the sign off first so "-00:30:00" comes out negative even though the leading component is zero
+	sign := 1.0
+	switch s[0] {
+	case '-':
+		sign = -1
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	// Accept colons, whitespace and the h/d/m/s unit letters as separators
+	parts := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ':' || r == ' ' || r == '\t' || r == 'h' || r == 'd' || r == 'm' || r == 's' || r == '°' || r == '\'' || r == '"'
+	})
+	if len(parts) == 0 || len(parts) > 3 {
+		return 0, fmt.Errorf("not a sexagesimal value: %q", s)
+	}
+
+	// A lone component is a plain number, a unit letter on its own ("12h") is more likely garbage than an angle
+	if len(parts) == 1 && parts[0] != s {
+		return 0, fmt.Errorf("not a sexagesimal value: %q", s)
+	}
+
+	value := 0.0
+	scale := 1.0
+	for i, part := range parts {
+		// Only plain digits, ParseFloat would also take exponents, hex and the like
+		if !SEXAGESIMAL_COMPONENT.MatchString(part) {
+			return 0, fmt.Errorf("not a sexagesimal value: %q", s)
+		}
+		component, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, fmt.Errorf("not a sexagesimal value: %q", s)
+		}
+
+		// Minutes and seconds must be within range, only the leading component may be anything
+		if i > 0 && component >= 60 {
+			return 0, fmt.Errorf("sexagesimal component out of range: %q", s)
+		}
+
+		value += component / scale
+		scale *= 60
+	}
+
+	return sign * value, nil
+}
+
+// parseAngle converts a sexagesimal string to an angle according to one of the PARSE_* modes
+func parseAngle(s string, mode int) (float64, error) {
+	value, err := parseSexagesimal(s)
+	if err != nil {
+		return 0, err
+	}
+
+	switch mode {
+	case PARSE_SEXAGESIMAL_HOURS_TO_DEG:
+		return value * 15, nil
+
+	case PARSE_SEXAGESIMAL_HOURS_TO_RAD:
+		return value * 15 * (math.Pi / 180), nil
+
+	case PARSE_SEXAGESIMAL_DEG_TO_DEG:
+		return value, nil
+
+	case PARSE_SEXAGESIMAL_DEG_TO_RAD:
+		return value * (math.Pi / 180), nil
+
+	default:
+		return 0, fmt.Errorf("Unknown parse mode: %d", mode)
+	}
+}
+
+// parseAngles converts a string series to angles.  Values that cannot be parsed are either kept as NaN or
+// dropped from the result along with their times, and are returned separately so the caller can report them.
+func parseAngles(times []time.Time, values []string, mode int, keep bool) ([]time.Time, []float64, []string, error) {
+
+	// Reject an unknown mode up front rather than counting every row as a failure
+	if _, err := parseAngle("0", mode); err != nil {
+		return nil, nil, nil, err
+	}
+
+	ptimes := make([]time.Time, 0, len(values))
+	pvalues := make([]float64, 0, len(values))
+	failures := []string{}
+
+	for i, s := range values {
+		angle, err := parseAngle(s, mode)
+		if err != nil {
+			failures = append(failures, s)
+			if !keep {
+				continue
+			}
+			angle = math.NaN()
+		}
+
+		ptimes = append(ptimes, times[i])
+		pvalues = append(pvalues, angle)
+	}
+
+	return ptimes, pvalues, failures, nil
+}
@@ -0,0 +1,62 @@
+package plugin
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestParseSexagesimal(t *testing.T) {
+	cases := map[string]float64{
+		"12:34:56.7": 12 + 34.0/60 + 56.7/3600,
+		"+45:12:03":  45 + 12.0/60 + 3.0/3600,
+		"-00:30:00":  -0.5,
+		"12 30":      12.5,
+		"45d12m03s":  45 + 12.0/60 + 3.0/3600,
+		" 7.25 ":     7.25,
+	}
+	for s, expected := range cases {
+		value, err := parseSexagesimal(s)
+		if err != nil {
+			t.Errorf("%q: %s", s, err)
+			continue
+		}
+		if math.Abs(value-expected) > 1e-9 {
+			t.Errorf("%q: expected %f, got %f", s, expected, value)
+		}
+	}
+
+	for _, s := range []string{"", "abc", "12:61:00", "1:2:3:4", "12:-5:00", "nan", "1e2", "0x1p4", "12h", "12:1e1:00", "inf"} {
+		if _, err := parseSexagesimal(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestParseAngles(t *testing.T) {
+	now := time.Now()
+	times := []time.Time{now, now.Add(time.Second), now.Add(2 * time.Second)}
+
+	ptimes, values, failures, err := parseAngles(times, []string{"06:00:00", "junk", "-01:00:00"}, PARSE_SEXAGESIMAL_HOURS_TO_DEG, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 2 || values[0] != 90 || values[1] != -15 {
+		t.Errorf("unexpected values %v", values)
+	}
+	if !ptimes[1].Equal(times[2]) {
+		t.Errorf("times not aligned with values")
+	}
+	if len(failures) != 1 || failures[0] != "junk" {
+		t.Errorf("unexpected failures %v", failures)
+	}
+
+	_, values, _, _ = parseAngles(times, []string{"06:00:00", "junk", "-01:00:00"}, PARSE_SEXAGESIMAL_HOURS_TO_DEG, true)
+	if len(values) != 3 || !math.IsNaN(values[1]) {
+		t.Errorf("expected the failure kept as NaN, got %v", values)
+	}
+
+	if _, _, _, err = parseAngles(times, []string{}, 99, false); err == nil {
+		t.Error("expected an error for an unknown parse mode")
+	}
+}
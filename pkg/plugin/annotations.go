@@ -0,0 +1,107 @@
+package plugin
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// keywordTexts gives every sample of a keyword as text: strings as they are, booleans normalized, enumerated values
+// as their labels and other numbers formatted.  Unreadable rows (NaN) are left out along with their times.
+func keywordTexts(keyword_type string, times []time.Time, values_strings []string, values_floats []float64, enumerators map[int64]string) ([]time.Time, []string) {
+	if keyword_type == "KTL_STRING" || isArrayType(keyword_type) {
+		return times, values_strings
+	}
+
+	if isBooleanType(keyword_type) {
+		texts := make([]string, len(values_strings))
+		for i, s := range values_strings {
+			texts[i] = s
+			if b, err := parseBoolean(s); err == nil {
+				texts[i] = strconv.FormatBool(b)
+			}
+		}
+		return times, texts
+	}
+
+	ttimes := make([]time.Time, 0, len(values_floats))
+	texts := make([]string, 0, len(values_floats))
+	for i, value := range values_floats {
+		if math.IsNaN(value) {
+			continue
+		}
+
+		text, ok := enumerators[int64(value)]
+		if !ok || float64(int64(value)) != value {
+			text = strconv.FormatFloat(value, 'g', -1, 64)
+		}
+
+		ttimes = append(ttimes, times[i])
+		texts = append(texts, text)
+	}
+
+	return ttimes, texts
+}
+
+// parseValueFilter splits a comma separated list of values into a set, an empty list gives nil (no filter)
+func parseValueFilter(list string) map[string]bool {
+	if strings.TrimSpace(list) == "" {
+		return nil
+	}
+
+	filter := map[string]bool{}
+	for _, value := range strings.Split(list, ",") {
+		filter[strings.TrimSpace(value)] = true
+	}
+	return filter
+}
+
+// transitionAnnotations builds an annotation frame with a row per change of value, spanning from the change to the
+// next one (or the end of the range).  The first sample is the value the changes are measured from, the caller puts
+// the last sample before the range there, so it isn't annotated itself.  With a filter only changes to the listed
+// values are returned.
+func transitionAnnotations(times []time.Time, texts []string, to time.Time, service string, keyword string, filter map[string]bool) *data.Frame {
+	starts := []time.Time{}
+	ends := []time.Time{}
+	labels := []string{}
+	tags := []string{}
+
+	tag := service + "," + keyword
+
+	for i := 1; i < len(texts); i++ {
+		if texts[i] == texts[i-1] {
+			continue
+		}
+
+		// The state lasts until the next change, any repeats in between don't end it
+		end := to
+		for j := i + 1; j < len(texts); j++ {
+			if texts[j] != texts[i] {
+				end = times[j]
+				break
+			}
+		}
+
+		if filter != nil && !filter[texts[i]] {
+			continue
+		}
+
+		starts = append(starts, times[i])
+		ends = append(ends, end)
+		labels = append(labels, keyword+" → "+texts[i])
+		tags = append(tags, tag)
+	}
+
+	frame := data.NewFrame("annotations",
+		data.NewField("time", nil, starts),
+		data.NewField("timeEnd", nil, ends),
+		data.NewField("text", nil, labels),
+		data.NewField("tags", nil, tags),
+	)
+	setFrameType(frame, data.FrameTypeTable)
+
+	return frame
+}
@@ -0,0 +1,72 @@
+package plugin
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestKeywordTexts(t *testing.T) {
+	now := time.Now()
+	times := []time.Time{now, now.Add(time.Second), now.Add(2 * time.Second)}
+
+	ttimes, texts := keywordTexts("KTL_ENUM", times, nil, []float64{0, math.NaN(), 3}, map[int64]string{0: "Closed"})
+	if len(texts) != 2 || texts[0] != "Closed" || texts[1] != "3" || !ttimes[1].Equal(times[2]) {
+		t.Errorf("unexpected texts %v", texts)
+	}
+
+	_, texts = keywordTexts("KTL_BOOLEAN", times, []string{"1", "off", "?"}, nil, nil)
+	if texts[0] != "true" || texts[1] != "false" || texts[2] != "?" {
+		t.Errorf("unexpected texts %v", texts)
+	}
+}
+
+func TestTransitionAnnotations(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	times := make([]time.Time, 5)
+	for i := range times {
+		times[i] = from.Add(time.Duration(i) * time.Minute)
+	}
+	texts := []string{"Closed", "Open", "Open", "Closed", "Open"}
+	to := from.Add(10 * time.Minute)
+
+	frame := transitionAnnotations(times, texts, to, "dome", "SHUTTER", nil)
+	if frame.Rows() != 3 {
+		t.Fatalf("expected 3 transitions, got %d", frame.Rows())
+	}
+	if !frame.Fields[1].At(0).(time.Time).Equal(times[3]) || !frame.Fields[1].At(2).(time.Time).Equal(to) {
+		t.Errorf("unexpected end times")
+	}
+	if frame.Fields[2].At(0) != "SHUTTER → Open" || frame.Fields[3].At(0) != "dome,SHUTTER" {
+		t.Errorf("unexpected text or tags %v %v", frame.Fields[2].At(0), frame.Fields[3].At(0))
+	}
+
+	frame = transitionAnnotations(times, texts, to, "dome", "SHUTTER", parseValueFilter("Closed"))
+	if frame.Rows() != 1 || !frame.Fields[0].At(0).(time.Time).Equal(times[3]) {
+		t.Errorf("expected only the change to Closed")
+	}
+}
+
+func TestTransitionAnnotationsPriorSample(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	times := []time.Time{from.Add(time.Minute)}
+	to := from.Add(10 * time.Minute)
+
+	// A single sample in the range is only a transition against the value before the range
+	ptimes, pstrings, _ := prependPrior(times, []string{"Open"}, nil, true, from, sql.NullString{String: "Closed", Valid: true}, 0)
+	frame := transitionAnnotations(ptimes, pstrings, to, "dome", "SHUTTER", nil)
+	if frame.Rows() != 1 || !frame.Fields[0].At(0).(time.Time).Equal(times[0]) {
+		t.Fatalf("expected the in-range change to be annotated, got %d rows", frame.Rows())
+	}
+
+	// Numeric keywords go through the number parsing, an unreadable prior value is left out
+	ptimes, _, pfloats := prependPrior(times, nil, []float64{1}, false, from, sql.NullString{String: "0", Valid: true}, 0)
+	if len(ptimes) != 2 || pfloats[0] != 0 || !ptimes[0].Equal(from) {
+		t.Errorf("unexpected prepended series %v %v", ptimes, pfloats)
+	}
+	ptimes, _, _ = prependPrior(times, nil, []float64{1}, false, from, sql.NullString{String: "?", Valid: true}, 0)
+	if len(ptimes) != 1 {
+		t.Errorf("expected an unreadable prior value to be left out")
+	}
+}
@@ -0,0 +1,147 @@
+package plugin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// The most elements we will split an array keyword into
+const ARRAY_MAX_ELEMENTS = 4096
+
+// The heatmap panel recognizes this frame type, the SDK has no constant for it
+const FRAME_TYPE_HEATMAP_CELLS data.FrameType = "heatmap-cells"
+
+// isArrayType reports whether a KTL type holds an array of numbers, e.g. KTL_DOUBLE_ARRAY
+func isArrayType(keyword_type string) bool {
+	return strings.HasSuffix(keyword_type, "_ARRAY")
+}
+
+// parseArray splits an archived array value such as "1.0 2.5 3" or "{1.0, 2.5, 3}" into its elements
+func parseArray(s string) ([]float64, error) {
+	s = strings.Trim(strings.TrimSpace(s), "[]{}()")
+
+	parts := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("empty array value: %q", s)
+	}
+	if len(parts) > ARRAY_MAX_ELEMENTS {
+		return nil, fmt.Errorf("array has %d elements, more than %d", len(parts), ARRAY_MAX_ELEMENTS)
+	}
+
+	elements := make([]float64, len(parts))
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid array element: %q", part)
+		}
+		elements[i] = value
+	}
+
+	return elements, nil
+}
+
+// parseArrays parses every row of an array keyword and applies the unit conversion to each element.  Rows that
+// cannot be parsed are either kept as empty rows (nulls in every element) or dropped along with their times, and
+// are returned separately so the caller can report them.
+func parseArrays(times []time.Time, values []string, conversion int, keep bool) ([]time.Time, [][]float64, []string, error) {
+	ptimes := make([]time.Time, 0, len(values))
+	arrays := make([][]float64, 0, len(values))
+	failures := []string{}
+
+	for i, s := range values {
+		elements, err := parseArray(s)
+		if err != nil {
+			failures = append(failures, s)
+			if !keep {
+				continue
+			}
+			elements = nil
+		}
+
+		for j := range elements {
+			elements[j], err = convertUnits(elements[j], conversion)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+		}
+
+		ptimes = append(ptimes, times[i])
+		arrays = append(arrays, elements)
+	}
+
+	return ptimes, arrays, failures, nil
+}
+
+// arrayElements returns the element indices to output, either the query's selection or every element seen
+func arrayElements(arrays [][]float64, selection string) ([]int, error) {
+	if selection != "" {
+		return parseIndexList(selection, ARRAY_MAX_ELEMENTS)
+	}
+
+	width := 0
+	for _, elements := range arrays {
+		if len(elements) > width {
+			width = len(elements)
+		}
+	}
+
+	selected := make([]int, width)
+	for i := range selected {
+		selected[i] = i
+	}
+	return selected, nil
+}
+
+// arrayFields builds one field per selected element, null where a row is too short to have that element
+func arrayFields(arrays [][]float64, selected []int) []*data.Field {
+	fields := make([]*data.Field, len(selected))
+
+	for i, index := range selected {
+		column := make([]*float64, len(arrays))
+		for j, elements := range arrays {
+			if index < len(elements) {
+				value := elements[index]
+				column[j] = &value
+			}
+		}
+		fields[i] = data.NewField(fmt.Sprintf("[%d]", index), nil, column)
+	}
+
+	return fields
+}
+
+// arrayHeatmapFrame builds a heatmap cells frame of element index against time, one cell per element per row
+func arrayHeatmapFrame(times []time.Time, arrays [][]float64, selected []int) *data.Frame {
+	xs := []time.Time{}
+	yMins := []float64{}
+	yMaxs := []float64{}
+	values := []float64{}
+
+	for i, elements := range arrays {
+		for _, index := range selected {
+			if index >= len(elements) {
+				continue
+			}
+			xs = append(xs, times[i])
+			yMins = append(yMins, float64(index))
+			yMaxs = append(yMaxs, float64(index+1))
+			values = append(values, elements[index])
+		}
+	}
+
+	frame := data.NewFrame("response",
+		data.NewField("xMax", nil, xs),
+		data.NewField("yMin", nil, yMins),
+		data.NewField("yMax", nil, yMaxs),
+		data.NewField("value", nil, values),
+	)
+	frame.SetMeta(&data.FrameMeta{Type: FRAME_TYPE_HEATMAP_CELLS})
+
+	return frame
+}
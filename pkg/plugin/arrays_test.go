@@ -0,0 +1,74 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseArray(t *testing.T) {
+	for _, s := range []string{"1.5 2 -3", "{1.5, 2, -3}", " [1.5,2,-3] "} {
+		elements, err := parseArray(s)
+		if err != nil {
+			t.Fatalf("%q: %s", s, err)
+		}
+		if len(elements) != 3 || elements[0] != 1.5 || elements[2] != -3 {
+			t.Errorf("%q: unexpected elements %v", s, elements)
+		}
+	}
+
+	for _, s := range []string{"1 two 3", "", " ", "{}"} {
+		if _, err := parseArray(s); err == nil {
+			t.Errorf("%q: expected an error for a bad array", s)
+		}
+	}
+}
+
+func TestArrayFields(t *testing.T) {
+	now := time.Now()
+	times := []time.Time{now, now.Add(time.Second), now.Add(2 * time.Second)}
+
+	ptimes, arrays, failures, err := parseArrays(times, []string{"1 2 3", "bad", "4 5"}, UNIT_CONVERT_NONE, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ptimes) != 2 || len(failures) != 1 {
+		t.Fatalf("expected 2 rows and 1 failure, got %d and %d", len(ptimes), len(failures))
+	}
+
+	selected, _ := arrayElements(arrays, "")
+	fields := arrayFields(arrays, selected)
+	if len(fields) != 3 || fields[2].Name != "[2]" {
+		t.Fatalf("expected three element fields")
+	}
+	if v, ok := fields[2].ConcreteAt(1); ok {
+		t.Errorf("expected a null for the missing element, got %v", v)
+	}
+
+	selected, _ = arrayElements(arrays, "1")
+	frame := arrayHeatmapFrame(ptimes, arrays, selected)
+	if frame.Rows() != 2 || frame.Fields[3].At(1).(float64) != 5 {
+		t.Errorf("unexpected heatmap cells")
+	}
+}
+
+func TestParseArraysKeep(t *testing.T) {
+	now := time.Now()
+	times := []time.Time{now, now.Add(time.Second), now.Add(2 * time.Second)}
+
+	// Kept, an unreadable row is null in every element and left out of the heatmap
+	ptimes, arrays, failures, err := parseArrays(times, []string{"1 2", "", "4 5"}, UNIT_CONVERT_NONE, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ptimes) != 3 || len(failures) != 1 || !ptimes[1].Equal(times[1]) {
+		t.Fatalf("expected 3 rows and 1 failure, got %d and %d", len(ptimes), len(failures))
+	}
+
+	fields := arrayFields(arrays, []int{0, 1})
+	if v, ok := fields[0].ConcreteAt(1); ok {
+		t.Errorf("expected a null for the unreadable row, got %v", v)
+	}
+	if frame := arrayHeatmapFrame(ptimes, arrays, []int{0, 1}); frame.Rows() != 4 {
+		t.Errorf("expected 4 heatmap cells, got %d", frame.Rows())
+	}
+}
@@ -0,0 +1,234 @@
+package plugin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet"
+	"github.com/apache/arrow-go/v18/parquet/compress"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+// Define the columnar export formats
+const (
+	EXPORT_FORMAT_ARROW   = "arrow"
+	EXPORT_FORMAT_PARQUET = "parquet"
+)
+
+// The most rows held in memory for one Parquet row group before it's written out
+const PARQUET_ROW_GROUP_ROWS = 1 << 20
+
+// exportColumns is the column layout of a columnar export.  Numeric keywords fill a float64 value column and the
+// others a string one; when an export mixes the two the string column is called text so both can be present.
+type exportColumns struct {
+	keyword bool
+	value   int
+	text    int
+}
+
+// exportLayout picks the columns an export needs, -1 marks a column that isn't present
+func exportLayout(keywords []exportKeyword) exportColumns {
+	numeric, text := false, false
+	for _, k := range keywords {
+		if k.numeric() {
+			numeric = true
+		} else {
+			text = true
+		}
+	}
+
+	columns := exportColumns{keyword: len(keywords) > 1, value: -1, text: -1}
+	next := 1
+	if columns.keyword {
+		next++
+	}
+	if numeric {
+		columns.value, next = next, next+1
+	}
+	if text {
+		columns.text = next
+	}
+
+	return columns
+}
+
+// loadExportMetadata gathers the metadata of every keyword of an export for recording in its schema
+func loadExportMetadata(db *sql.DB, config *DatasourceSettings, keywords []exportKeyword) ([]*keywordMetadata, error) {
+	metadata := make([]*keywordMetadata, len(keywords))
+	for i, k := range keywords {
+		var err error
+		metadata[i], err = loadKeywordMetadata(db, config, k.service, k.keyword)
+		if err != nil {
+			return nil, tableError(err, k.service)
+		}
+	}
+	return metadata, nil
+}
+
+// exportSchema builds the typed schema of a columnar export: time in ns, the keyword when there are several, and
+// the value.  The range, processing and each keyword's metadata (as JSON) go in the schema metadata, and a single
+// keyword's units and type are on its value column too.
+func exportSchema(request exportRequest, columns exportColumns, metadata []*keywordMetadata) *arrow.Schema {
+	fields := []arrow.Field{{Name: "time", Type: &arrow.TimestampType{Unit: arrow.Nanosecond, TimeZone: "UTC"}}}
+	if columns.keyword {
+		fields = append(fields, arrow.Field{Name: "keyword", Type: arrow.BinaryTypes.String})
+	}
+
+	var field_metadata arrow.Metadata
+	if len(metadata) == 1 && metadata[0] != nil {
+		field_metadata = arrow.NewMetadata(
+			[]string{"service", "keyword", "type", "units"},
+			[]string{metadata[0].Service, metadata[0].Keyword, metadata[0].Type, metadata[0].Units},
+		)
+	}
+	if columns.value >= 0 {
+		fields = append(fields, arrow.Field{Name: "value", Type: arrow.PrimitiveTypes.Float64, Nullable: true, Metadata: field_metadata})
+	}
+	if columns.text >= 0 {
+		name := "text"
+		if columns.value < 0 {
+			name = "value"
+		}
+		fields = append(fields, arrow.Field{Name: name, Type: arrow.BinaryTypes.String, Nullable: true, Metadata: field_metadata})
+	}
+
+	names := make([]string, len(request.keywords))
+	for i, k := range request.keywords {
+		names[i] = k.name()
+	}
+	keys := []string{"keywords", "from", "to", "unitConversion", "transform"}
+	values := []string{
+		strings.Join(names, ","),
+		request.from.UTC().Format(time.RFC3339Nano),
+		request.to.UTC().Format(time.RFC3339Nano),
+		strconv.Itoa(request.qm.UnitConversion),
+		strconv.Itoa(request.qm.Transform),
+	}
+	for _, m := range metadata {
+		if m == nil {
+			continue
+		}
+		if encoded, err := json.Marshal(m); err == nil {
+			keys = append(keys, "keyword:"+m.Service+"."+m.Keyword)
+			values = append(values, string(encoded))
+		}
+	}
+	schema_metadata := arrow.NewMetadata(keys, values)
+
+	return arrow.NewSchema(fields, &schema_metadata)
+}
+
+// exportRecord builds a record batch from one chunk of a keyword's samples, the caller releases it
+func exportRecord(builder *array.RecordBuilder, columns exportColumns, k exportKeyword, samples []exportSample) arrow.Record {
+	times := builder.Field(0).(*array.TimestampBuilder)
+	for _, sample := range samples {
+		times.Append(arrow.Timestamp(sample.time.UnixNano()))
+	}
+
+	if columns.keyword {
+		keywords := builder.Field(1).(*array.StringBuilder)
+		for range samples {
+			keywords.Append(k.name())
+		}
+	}
+
+	if columns.value >= 0 {
+		values := builder.Field(columns.value).(*array.Float64Builder)
+		for _, sample := range samples {
+			if k.numeric() {
+				values.Append(sample.value)
+			} else {
+				values.AppendNull()
+			}
+		}
+	}
+
+	if columns.text >= 0 {
+		texts := builder.Field(columns.text).(*array.StringBuilder)
+		for _, sample := range samples {
+			if k.numeric() {
+				texts.AppendNull()
+			} else {
+				texts.Append(sample.text)
+			}
+		}
+	}
+
+	return builder.NewRecord()
+}
+
+// streamRecords streams every keyword of an export a chunk at a time, handing each chunk to write as a record
+func streamRecords(db *sql.DB, request exportRequest, schema *arrow.Schema, columns exportColumns, write func(arrow.Record) error) error {
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer builder.Release()
+
+	for _, k := range request.keywords {
+		err := streamKeyword(db, k, request.from, request.to, request.qm, false, func(samples []exportSample) error {
+			record := exportRecord(builder, columns, k, samples)
+			defer record.Release()
+			return write(record)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeArrow streams the export as an Arrow IPC stream, a record batch per chunk
+func writeArrow(db *sql.DB, w io.Writer, request exportRequest, metadata []*keywordMetadata, flush func() error) error {
+	columns := exportLayout(request.keywords)
+	schema := exportSchema(request, columns, metadata)
+
+	writer := ipc.NewWriter(w, ipc.WithSchema(schema))
+	err := streamRecords(db, request, schema, columns, func(record arrow.Record) error {
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+		return flush()
+	})
+	if err != nil {
+		writer.Close()
+		return err
+	}
+
+	return writer.Close()
+}
+
+// writeParquet streams the export as a Snappy compressed Parquet file.  Rows are buffered a row group at a time,
+// each one is written out as it fills, and the footer goes last.
+func writeParquet(db *sql.DB, w io.Writer, request exportRequest, metadata []*keywordMetadata, flush func() error) error {
+	columns := exportLayout(request.keywords)
+	schema := exportSchema(request, columns, metadata)
+
+	props := parquet.NewWriterProperties(
+		parquet.WithCompression(compress.Codecs.Snappy),
+		parquet.WithMaxRowGroupLength(PARQUET_ROW_GROUP_ROWS),
+	)
+	writer, err := pqarrow.NewFileWriter(schema, w, props, pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema()))
+	if err != nil {
+		return err
+	}
+
+	err = streamRecords(db, request, schema, columns, func(record arrow.Record) error {
+		if err := writer.WriteBuffered(record); err != nil {
+			return err
+		}
+		return flush()
+	})
+	if err != nil {
+		writer.Close()
+		return err
+	}
+
+	return writer.Close()
+}
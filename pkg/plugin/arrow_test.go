@@ -0,0 +1,129 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+)
+
+func TestExportLayout(t *testing.T) {
+	az := exportKeyword{service: "dcs", keyword: "AZ", keyword_type: "KTL_DOUBLE"}
+	name := exportKeyword{service: "dcs", keyword: "TARGNAME", keyword_type: "KTL_STRING"}
+
+	cases := []struct {
+		keywords []exportKeyword
+		expected exportColumns
+	}{
+		{[]exportKeyword{az}, exportColumns{keyword: false, value: 1, text: -1}},
+		{[]exportKeyword{name}, exportColumns{keyword: false, value: -1, text: 1}},
+		{[]exportKeyword{az, name}, exportColumns{keyword: true, value: 2, text: 3}},
+	}
+
+	for i, c := range cases {
+		if columns := exportLayout(c.keywords); columns != c.expected {
+			t.Errorf("case %d: expected %v, got %v", i, c.expected, columns)
+		}
+	}
+}
+
+func exportTestRecord(t *testing.T) (*arrow.Schema, arrow.Record) {
+	az := exportKeyword{service: "dcs", keyword: "AZ", keyword_type: "KTL_DOUBLE"}
+	request := exportRequest{
+		keywords: []exportKeyword{az},
+		from:     time.Unix(1700000000, 0),
+		to:       time.Unix(1700003600, 0),
+	}
+	metadata := []*keywordMetadata{{Service: "dcs", Keyword: "AZ", Type: "KTL_DOUBLE", Units: "deg"}}
+
+	columns := exportLayout(request.keywords)
+	schema := exportSchema(request, columns, metadata)
+	if units, _ := schema.Field(1).Metadata.GetValue("units"); units != "deg" {
+		t.Errorf("unexpected units %q", units)
+	}
+	if _, ok := schema.Metadata().GetValue("keyword:dcs.AZ"); !ok {
+		t.Error("expected the keyword metadata in the schema")
+	}
+
+	builder := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer builder.Release()
+
+	samples := []exportSample{
+		{time: time.Unix(1700000000, 5), value: 1.5},
+		{time: time.Unix(1700000001, 0), value: -2},
+	}
+	return schema, exportRecord(builder, columns, az, samples)
+}
+
+func TestArrowRoundTrip(t *testing.T) {
+	schema, record := exportTestRecord(t)
+	defer record.Release()
+
+	var buf bytes.Buffer
+	writer := ipc.NewWriter(&buf, ipc.WithSchema(schema))
+	if err := writer.Write(record); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := ipc.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Release()
+
+	if !reader.Next() {
+		t.Fatal("expected a record batch")
+	}
+	read := reader.Record()
+	times := read.Column(0).(*array.Timestamp)
+	values := read.Column(1).(*array.Float64)
+	if read.NumRows() != 2 || times.Value(0) != arrow.Timestamp(1700000000000000005) || values.Value(1) != -2 {
+		t.Errorf("unexpected record %v", read)
+	}
+}
+
+func TestParquetRoundTrip(t *testing.T) {
+	schema, record := exportTestRecord(t)
+	defer record.Release()
+
+	var buf bytes.Buffer
+	writer, err := pqarrow.NewFileWriter(schema, &buf, nil, pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writer.WriteBuffered(record); err != nil {
+		t.Fatal(err)
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := file.NewParquetReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	arrowReader, err := pqarrow.NewFileReader(reader, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table, err := arrowReader.ReadTable(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer table.Release()
+
+	values := table.Column(1).Data().Chunk(0).(*array.Float64)
+	if table.NumRows() != 2 || values.Value(0) != 1.5 {
+		t.Errorf("unexpected table of %d rows", table.NumRows())
+	}
+}
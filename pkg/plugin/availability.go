@@ -0,0 +1,269 @@
+package plugin
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/lib/pq"
+)
+
+// Define the availability buckets, this maps onto the bucketOptions list in QueryEditor.tsx.  Days and nights are
+// the site's: a day runs from local midnight, and a night from local noon to local noon so a whole observing night
+// lands in one bucket.
+const (
+	AVAILABILITY_BUCKET_HOUR  = "hour"
+	AVAILABILITY_BUCKET_DAY   = "day"
+	AVAILABILITY_BUCKET_NIGHT = "night"
+)
+
+// availabilityGap is an interval with no samples at all
+type availabilityGap struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// availabilityBucket is the number of samples archived in one bucket
+type availabilityBucket struct {
+	Start time.Time `json:"start"`
+	Count int64     `json:"count"`
+}
+
+// availability is what the /availability resource returns, the buckets and gaps in time order
+type availability struct {
+	Buckets []availabilityBucket `json:"buckets"`
+	Gaps    []availabilityGap    `json:"gaps"`
+}
+
+// bucketOrigin returns the start of the bucket holding an instant along with the bucket width.  Days start at local
+// midnight and nights at local noon, with the site's time zone taken from its longitude to the nearest hour (HST,
+// UTC-10, for Maunakea).
+func bucketOrigin(from time.Time, bucket string, longitude float64) (time.Time, time.Duration, error) {
+	from = from.UTC()
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	zone := time.Duration(math.Round(longitude/15)) * time.Hour
+
+	// The local time of day a bucket starts at, for the buckets that follow the site's days
+	var start time.Duration
+	switch bucket {
+	case "", AVAILABILITY_BUCKET_HOUR:
+		return from.Truncate(time.Hour), time.Hour, nil
+
+	case AVAILABILITY_BUCKET_DAY:
+		start = 0
+
+	case AVAILABILITY_BUCKET_NIGHT:
+		start = 12 * time.Hour
+
+	default:
+		return time.Time{}, 0, fmt.Errorf("unknown bucket: %q, expected hour, day or night", bucket)
+	}
+
+	origin := day.Add(start - zone)
+	for origin.After(from) {
+		origin = origin.Add(-24 * time.Hour)
+	}
+	for !origin.Add(24 * time.Hour).After(from) {
+		origin = origin.Add(24 * time.Hour)
+	}
+	return origin, 24 * time.Hour, nil
+}
+
+// bucketCount is how many buckets of the given width are needed to cover the range from the origin
+func bucketCount(origin time.Time, width time.Duration, to time.Time) int {
+	if !to.After(origin) {
+		return 0
+	}
+	return int((to.Sub(origin) + width - 1) / width)
+}
+
+// loadAvailability counts the samples of a keyword in each bucket from the origin on, one grouped statement.  The
+// first and last buckets usually overhang the range, only the samples within it are counted.
+func loadAvailability(db *sql.DB, service string, keyword string, origin time.Time, width time.Duration, buckets int, from time.Time, to time.Time) ([]int64, error) {
+	sql_buckets := fmt.Sprintf(`select floor((time - $2) / $3)::bigint as bucket, count(*) from %s
+		where keyword = $1 and time >= $4 and time <= $5 group by bucket order by bucket;`, pq.QuoteIdentifier(service))
+
+	start := float64(origin.UnixNano()) * 1e-9
+	from_u := float64(from.UnixNano()) * 1e-9
+	to_u := float64(to.UnixNano()) * 1e-9
+	rows, err := db.Query(sql_buckets, keyword, start, width.Seconds(), from_u, to_u)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make([]int64, buckets)
+	var bucket, count int64
+	for rows.Next() {
+		err = rows.Scan(&bucket, &count)
+		if err != nil {
+			return nil, err
+		}
+		if bucket >= 0 && bucket < int64(buckets) {
+			counts[bucket] = count
+		}
+	}
+
+	return counts, rows.Err()
+}
+
+// availabilityGaps merges runs of empty buckets into intervals with no data
+func availabilityGaps(origin time.Time, width time.Duration, counts []int64) []availabilityGap {
+	gaps := []availabilityGap{}
+
+	for i := 0; i < len(counts); i++ {
+		if counts[i] != 0 {
+			continue
+		}
+		start := i
+		for i+1 < len(counts) && counts[i+1] == 0 {
+			i++
+		}
+		gaps = append(gaps, availabilityGap{
+			Start: origin.Add(time.Duration(start) * width),
+			End:   origin.Add(time.Duration(i+1) * width),
+		})
+	}
+
+	return gaps
+}
+
+// keywordAvailability counts a keyword's samples per bucket across a range and finds the gaps between them
+func keywordAvailability(db *sql.DB, config *DatasourceSettings, service string, keyword string, from time.Time, to time.Time, bucket string) (availability, error) {
+	result := availability{Buckets: []availabilityBucket{}, Gaps: []availabilityGap{}}
+
+	if service == EPHEM_SERVICE {
+		return result, badRequest(fmt.Errorf("%s keywords are computed, not archived", EPHEM_SERVICE))
+	}
+
+	_, longitude, err := config.siteLocation()
+	if err != nil {
+		return result, err
+	}
+	origin, width, err := bucketOrigin(from, bucket, longitude)
+	if err != nil {
+		return result, badRequest(err)
+	}
+
+	buckets := bucketCount(origin, width, to)
+	if buckets > QUERY_MAX_POINTS {
+		return result, badRequest(fmt.Errorf("%d %s buckets is more than %d, pick a longer bucket or a shorter range", buckets, bucket, QUERY_MAX_POINTS))
+	}
+
+	counts, err := loadAvailability(db, service, keyword, origin, width, buckets, from, to)
+	if err != nil {
+		return result, tableError(err, service)
+	}
+
+	for i, count := range counts {
+		result.Buckets = append(result.Buckets, availabilityBucket{Start: origin.Add(time.Duration(i) * width), Count: count})
+	}
+	result.Gaps = availabilityGaps(origin, width, counts)
+
+	return result, nil
+}
+
+// queryAvailability returns the sample counts per bucket as a time series, for a bar chart or heatmap, and the
+// gaps as a second frame of intervals
+func queryAvailability(db *sql.DB, config *DatasourceSettings, query backend.DataQuery, qm queryModel, service string, keyword string) backend.DataResponse {
+	response := backend.DataResponse{}
+
+	result, err := keywordAvailability(db, config, service, keyword, query.TimeRange.From, query.TimeRange.To, qm.Bucket)
+	if err != nil {
+		log.DefaultLogger.Error(fl() + "availability error: " + err.Error())
+		response.Error = err
+		return response
+	}
+
+	counts, gaps := availabilityFrames(result, service, keyword)
+	counts.Name = qm.QueryText
+	counts.RefID = qm.RefId
+	gaps.RefID = qm.RefId
+
+	response.Frames = append(response.Frames, counts, gaps)
+	return response
+}
+
+// availabilityFrames builds the bucket count time series and the table of gaps
+func availabilityFrames(result availability, service string, keyword string) (*data.Frame, *data.Frame) {
+	times := make([]time.Time, len(result.Buckets))
+	counts := make([]int64, len(result.Buckets))
+	for i, bucket := range result.Buckets {
+		times[i] = bucket.Start
+		counts[i] = bucket.Count
+	}
+
+	countFrame := data.NewFrame("availability",
+		data.NewField("time", nil, times),
+		data.NewField("count", nil, counts),
+	)
+	setFrameType(countFrame, data.FrameTypeTimeSeriesMulti)
+
+	starts := make([]time.Time, len(result.Gaps))
+	ends := make([]time.Time, len(result.Gaps))
+	durations := make([]float64, len(result.Gaps))
+	texts := make([]string, len(result.Gaps))
+	for i, gap := range result.Gaps {
+		starts[i] = gap.Start
+		ends[i] = gap.End
+		durations[i] = gap.End.Sub(gap.Start).Seconds()
+		texts[i] = fmt.Sprintf("no %s.%s data for %s", service, keyword, gap.End.Sub(gap.Start))
+	}
+
+	gapFrame := data.NewFrame("gaps",
+		data.NewField("time", nil, starts),
+		data.NewField("timeEnd", nil, ends),
+		data.NewField("duration", nil, durations).SetConfig(&data.FieldConfig{Unit: "s"}),
+		data.NewField("text", nil, texts),
+	)
+	setFrameType(gapFrame, data.FrameTypeTable)
+
+	return countFrame, gapFrame
+}
+
+// handleResourceAvailability answers /availability?service=S&keyword=K&from=T&to=T&bucket=hour|day|night with the
+// sample counts per bucket and the gaps, the range defaults to the last week
+func (ds *KeywordDatasource) handleResourceAvailability(rw http.ResponseWriter, req *http.Request) {
+	params, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		writeError(rw, badRequest(err))
+		return
+	}
+	service, keyword := params.Get("service"), params.Get("keyword")
+	if service == "" || keyword == "" {
+		writeError(rw, badRequest(fmt.Errorf("expected service and keyword parameters")))
+		return
+	}
+
+	to, err := parseInstant(params.Get("to"), time.Now())
+	if err != nil {
+		writeError(rw, badRequest(err))
+		return
+	}
+	from, err := parseInstant(params.Get("from"), to.Add(-7*24*time.Hour))
+	if err != nil {
+		writeError(rw, badRequest(err))
+		return
+	}
+
+	cfg, db, err := openResourceDatabase(req)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	defer db.Close()
+
+	result, err := keywordAvailability(db, cfg, service, keyword, from, to, params.Get("bucket"))
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+
+	writeResult(rw, result)
+}
@@ -0,0 +1,83 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketOrigin(t *testing.T) {
+	from := time.Date(2024, 3, 5, 8, 30, 0, 0, time.UTC)
+
+	cases := []struct {
+		bucket   string
+		expected time.Time
+	}{
+		{AVAILABILITY_BUCKET_HOUR, time.Date(2024, 3, 5, 8, 0, 0, 0, time.UTC)},
+		// Midnight in Hawaii is 10:00 UTC, 08:30 UTC is still the local day before
+		{AVAILABILITY_BUCKET_DAY, time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)},
+		// Noon in Hawaii is 22:00 UTC, 08:30 UTC belongs to the night that started the day before
+		{AVAILABILITY_BUCKET_NIGHT, time.Date(2024, 3, 4, 22, 0, 0, 0, time.UTC)},
+	}
+
+	for _, c := range cases {
+		origin, width, err := bucketOrigin(from, c.bucket, EPHEM_DEFAULT_LONGITUDE)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", c.bucket, err)
+		}
+		if !origin.Equal(c.expected) {
+			t.Errorf("%s: expected origin %s, got %s", c.bucket, c.expected, origin)
+		}
+		if !origin.Add(width).After(from) || origin.After(from) {
+			t.Errorf("%s: bucket doesn't hold the start of the range", c.bucket)
+		}
+	}
+
+	// After local noon the night is the one starting that day
+	origin, _, _ := bucketOrigin(time.Date(2024, 3, 5, 23, 0, 0, 0, time.UTC), AVAILABILITY_BUCKET_NIGHT, EPHEM_DEFAULT_LONGITUDE)
+	if !origin.Equal(time.Date(2024, 3, 5, 22, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected night origin %s", origin)
+	}
+
+	// At Greenwich the days are UTC days
+	origin, _, _ = bucketOrigin(from, AVAILABILITY_BUCKET_DAY, 0)
+	if !origin.Equal(time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected UTC day origin %s", origin)
+	}
+
+	if _, _, err := bucketOrigin(from, "week", 0); err == nil {
+		t.Error("expected an error for an unknown bucket")
+	}
+}
+
+func TestBucketCount(t *testing.T) {
+	origin := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+
+	if n := bucketCount(origin, time.Hour, origin.Add(90*time.Minute)); n != 2 {
+		t.Errorf("expected 2 buckets, got %d", n)
+	}
+	if n := bucketCount(origin, time.Hour, origin.Add(2*time.Hour)); n != 2 {
+		t.Errorf("expected 2 buckets, got %d", n)
+	}
+	if n := bucketCount(origin, time.Hour, origin); n != 0 {
+		t.Errorf("expected no buckets, got %d", n)
+	}
+}
+
+func TestAvailabilityGaps(t *testing.T) {
+	origin := time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)
+	gaps := availabilityGaps(origin, time.Hour, []int64{0, 0, 5, 3, 0, 7, 0})
+
+	expected := []availabilityGap{
+		{origin, origin.Add(2 * time.Hour)},
+		{origin.Add(4 * time.Hour), origin.Add(5 * time.Hour)},
+		{origin.Add(6 * time.Hour), origin.Add(7 * time.Hour)},
+	}
+	if len(gaps) != len(expected) {
+		t.Fatalf("expected %d gaps, got %v", len(expected), gaps)
+	}
+	for i, gap := range expected {
+		if !gaps[i].Start.Equal(gap.Start) || !gaps[i].End.Equal(gap.End) {
+			t.Errorf("gap %d: expected %v, got %v", i, gap, gaps[i])
+		}
+	}
+}
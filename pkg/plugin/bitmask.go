@@ -0,0 +1,152 @@
+package plugin
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// The widest mask we will decode
+const BITMASK_MAX_BITS = 64
+
+// parseBitList parses an explicit bit selection such as "0,3,5-7" into a sorted list of bit numbers
+func parseBitList(list string) ([]int, error) {
+	return parseIndexList(list, BITMASK_MAX_BITS)
+}
+
+// parseIndexList parses a selection such as "0,3,5-7" into a sorted list of indices below the limit
+func parseIndexList(list string, limit int) ([]int, error) {
+	selected := map[int]bool{}
+
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		low, high, isRange := strings.Cut(entry, "-")
+		first, err := strconv.Atoi(strings.TrimSpace(low))
+		if err != nil {
+			return nil, fmt.Errorf("invalid index: %q", entry)
+		}
+		last := first
+		if isRange {
+			last, err = strconv.Atoi(strings.TrimSpace(high))
+			if err != nil {
+				return nil, fmt.Errorf("invalid index range: %q", entry)
+			}
+		}
+
+		if first < 0 || last >= limit || first > last {
+			return nil, fmt.Errorf("index out of range: %q", entry)
+		}
+		for index := first; index <= last; index++ {
+			selected[index] = true
+		}
+	}
+
+	result := make([]int, 0, len(selected))
+	for index := range selected {
+		result = append(result, index)
+	}
+	sort.Ints(result)
+
+	return result, nil
+}
+
+// parseMask reads a mask or status word from its archived text as an exact integer, going through a float would
+// lose the bits above 2^53.  KTL integers are 32 bits, so a negative status word is taken as its 32 bit two's
+// complement rather than having every bit above set.
+func parseMask(s string) (uint64, error) {
+	s = strings.TrimSpace(s)
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return u, nil
+	}
+
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		// Some archives write integers with a decimal point, those are fine as long as they are exact
+		f, ferr := strconv.ParseFloat(s, 64)
+		if ferr != nil || f != math.Trunc(f) || math.Abs(f) > 1<<53 {
+			return 0, fmt.Errorf("not an integer mask: %q", s)
+		}
+		if f >= 0 {
+			return uint64(f), nil
+		}
+		i = int64(f)
+	}
+
+	if i < math.MinInt32 {
+		return 0, fmt.Errorf("negative mask wider than 32 bits: %q", s)
+	}
+	return uint64(uint32(int32(i))), nil
+}
+
+// parseMasks reads every archived mask value, nil where a value isn't an integer
+func parseMasks(values []string) []*uint64 {
+	masks := make([]*uint64, len(values))
+	for i, s := range values {
+		if mask, err := parseMask(s); err == nil {
+			masks[i] = &mask
+		}
+	}
+	return masks
+}
+
+// maskBits picks the bits to decode when the query doesn't list them: the named bits if the keyword has any,
+// otherwise every bit up to the highest one seen set in the data
+func maskBits(masks []*uint64, names map[int64]string) []int {
+	result := []int{}
+
+	if len(names) > 0 {
+		for bit := range names {
+			if bit >= 0 && bit < BITMASK_MAX_BITS {
+				result = append(result, int(bit))
+			}
+		}
+		sort.Ints(result)
+		return result
+	}
+
+	var seen uint64
+	for _, mask := range masks {
+		if mask != nil {
+			seen |= *mask
+		}
+	}
+	for bit := 0; bit < bits.Len64(seen); bit++ {
+		result = append(result, bit)
+	}
+
+	return result
+}
+
+// decodeBitmask splits mask values into one boolean field per requested bit, named after the bit where possible.
+// An unreadable value is null in every field.
+func decodeBitmask(masks []*uint64, selected []int, names map[int64]string) []*data.Field {
+	fields := make([]*data.Field, len(selected))
+
+	for i, bit := range selected {
+		flags := make([]*bool, len(masks))
+		for j, mask := range masks {
+			if mask == nil {
+				continue
+			}
+			flag := *mask&(1<<uint(bit)) != 0
+			flags[j] = &flag
+		}
+
+		name := fmt.Sprintf("bit %d", bit)
+		if label, ok := names[int64(bit)]; ok && label != "" {
+			name = label
+		}
+		fields[i] = data.NewField(name, nil, flags)
+	}
+
+	return fields
+}
@@ -0,0 +1,100 @@
+package plugin
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseBitList(t *testing.T) {
+	selected, err := parseBitList("5-7, 0,3,6")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []int{0, 3, 5, 6, 7}
+	if len(selected) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, selected)
+	}
+	for i := range expected {
+		if selected[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, selected)
+		}
+	}
+
+	for _, list := range []string{"x", "3-1", "64", "-1"} {
+		if _, err := parseBitList(list); err == nil {
+			t.Errorf("%q: expected an error", list)
+		}
+	}
+}
+
+func TestDecodeBitmask(t *testing.T) {
+	masks := parseMasks([]string{"0", "5", "8"})
+
+	if selected := maskBits(masks, nil); len(selected) != 4 {
+		t.Errorf("expected bits 0-3 from the data, got %v", selected)
+	}
+
+	names := map[int64]string{0: "POWER", 2: "FAULT"}
+	selected := maskBits(masks, names)
+	if len(selected) != 2 || selected[0] != 0 || selected[1] != 2 {
+		t.Errorf("expected the named bits, got %v", selected)
+	}
+
+	fields := decodeBitmask(masks, []int{0, 2, 3}, names)
+	if fields[0].Name != "POWER" || fields[1].Name != "FAULT" || fields[2].Name != "bit 3" {
+		t.Errorf("unexpected field names %s, %s, %s", fields[0].Name, fields[1].Name, fields[2].Name)
+	}
+	at := func(field int, row int) bool {
+		flag, _ := fields[field].ConcreteAt(row)
+		return flag.(bool)
+	}
+	if !at(0, 1) || !at(1, 1) || at(2, 1) || !at(2, 2) {
+		t.Errorf("unexpected bit values")
+	}
+}
+
+func TestParseMask(t *testing.T) {
+	cases := map[string]uint64{
+		"5":                    5,
+		" 8.0 ":                8,
+		"9007199254740993":     1<<53 + 1,
+		"18446744073709551615": math.MaxUint64,
+		"-1":                   0xffffffff,
+		"-2147483648":          0x80000000,
+	}
+	for s, expected := range cases {
+		mask, err := parseMask(s)
+		if err != nil {
+			t.Errorf("%q: %s", s, err)
+			continue
+		}
+		if mask != expected {
+			t.Errorf("%q: expected %#x, got %#x", s, expected, mask)
+		}
+	}
+
+	for _, s := range []string{"", "1.5", "junk", "nan", "-2147483649"} {
+		if _, err := parseMask(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+
+	// Bit 53 survives, a float would have rounded it away, and a negative word only sets the low 32 bits
+	masks := parseMasks([]string{"9007199254740993", "-1", "junk"})
+	if selected := maskBits(masks, nil); len(selected) != 54 {
+		t.Errorf("expected bits 0-53, got %d bits", len(selected))
+	}
+	fields := decodeBitmask(masks, []int{0, 31, 32}, nil)
+	if v, _ := fields[0].ConcreteAt(0); v != true {
+		t.Error("expected bit 0 set above 2^53")
+	}
+	if v, _ := fields[1].ConcreteAt(1); v != true {
+		t.Error("expected bit 31 set for -1")
+	}
+	if v, _ := fields[2].ConcreteAt(1); v != false {
+		t.Error("expected bit 32 clear for -1")
+	}
+	if _, ok := fields[0].ConcreteAt(2); ok {
+		t.Error("expected a null for an unreadable mask")
+	}
+}
@@ -0,0 +1,87 @@
+package plugin
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// isBooleanType reports whether a KTL type is a boolean
+func isBooleanType(keyword_type string) bool {
+	return keyword_type == "KTL_BOOLEAN"
+}
+
+// parseBoolean normalizes the textual forms a boolean keyword is archived with
+func parseBoolean(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true", "t", "yes", "y", "on", "1":
+		return true, nil
+	case "false", "f", "no", "n", "off", "0":
+		return false, nil
+	}
+
+	// Anything else numeric follows the usual C convention
+	value, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return false, fmt.Errorf("not a boolean value: %q", s)
+	}
+	return value != 0, nil
+}
+
+// parseBooleans converts a string series to booleans.  Values that cannot be parsed are either kept as nulls or
+// dropped from the result along with their times, and are returned separately so the caller can report them.
+func parseBooleans(times []time.Time, values []string, keep bool) ([]time.Time, []*bool, []string) {
+	ptimes := make([]time.Time, 0, len(values))
+	pvalues := make([]*bool, 0, len(values))
+	failures := []string{}
+
+	for i, s := range values {
+		var pvalue *bool
+		value, err := parseBoolean(s)
+		if err == nil {
+			pvalue = &value
+		} else {
+			failures = append(failures, s)
+			if !keep {
+				continue
+			}
+		}
+
+		ptimes = append(ptimes, times[i])
+		pvalues = append(pvalues, pvalue)
+	}
+
+	return ptimes, pvalues, failures
+}
+
+// trueDuration totals the time a boolean series spent true within the range, holding each sample until the next one
+// and the last one until the end of the range.  A sample from before the range (the value in force at its start)
+// counts from the start of the range.  Nothing is known before the first sample or during a null.
+func trueDuration(times []time.Time, values []*bool, from time.Time, to time.Time) time.Duration {
+	var total time.Duration
+
+	for i := range values {
+		if values[i] == nil || !*values[i] {
+			continue
+		}
+
+		start := times[i]
+		if start.Before(from) {
+			start = from
+		}
+		end := to
+		if i+1 < len(times) {
+			end = times[i+1]
+		}
+		if end.After(to) {
+			end = to
+		}
+		if end.After(start) {
+			total += end.Sub(start)
+		}
+	}
+
+	return total
+}
@@ -0,0 +1,57 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseBoolean(t *testing.T) {
+	cases := map[string]bool{"true": true, "False": false, " 1 ": true, "0": false, "ON": true, "no": false, "2": true, "0.0": false}
+	for s, expected := range cases {
+		value, err := parseBoolean(s)
+		if err != nil {
+			t.Errorf("%q: %s", s, err)
+			continue
+		}
+		if value != expected {
+			t.Errorf("%q: expected %v", s, expected)
+		}
+	}
+
+	for _, s := range []string{"maybe", "nan", "NaN", "inf", "-Inf", ""} {
+		if _, err := parseBoolean(s); err == nil {
+			t.Errorf("%q: expected an error for a non-boolean", s)
+		}
+	}
+}
+
+func TestTrueDuration(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	times := []time.Time{from, from.Add(10 * time.Second), from.Add(30 * time.Second), from.Add(35 * time.Second)}
+
+	btimes, values, failures := parseBooleans(times, []string{"true", "false", "junk", "1"}, false)
+	if len(failures) != 1 || len(values) != 3 {
+		t.Fatalf("expected 3 values and 1 failure, got %d and %d", len(values), len(failures))
+	}
+
+	// True for the first 10s, then again from 35s to the end of the range at 60s
+	if d := trueDuration(btimes, values, from, from.Add(time.Minute)); d != 35*time.Second {
+		t.Errorf("expected 35s true, got %s", d)
+	}
+
+	// Kept as a null the unreadable row still holds its place, and isn't counted as true
+	btimes, values, failures = parseBooleans(times, []string{"true", "junk", "false", "1"}, true)
+	if len(failures) != 1 || len(values) != 4 || values[1] != nil {
+		t.Fatalf("expected the unreadable row kept as a null, got %v", values)
+	}
+	if d := trueDuration(btimes, values, from, from.Add(time.Minute)); d != 35*time.Second {
+		t.Errorf("expected 35s true, got %s", d)
+	}
+
+	// Already true from a sample before the range, counted from the start of the range until it goes false at 10s
+	before := []time.Time{from.Add(-time.Hour), from.Add(10 * time.Second)}
+	btimes, values, _ = parseBooleans(before, []string{"true", "false"}, false)
+	if d := trueDuration(btimes, values, from, from.Add(time.Minute)); d != 10*time.Second {
+		t.Errorf("expected 10s true, got %s", d)
+	}
+}
@@ -0,0 +1,395 @@
+package plugin
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/lib/pq"
+)
+
+// Define how keywords that changed around an instant are ranked, this maps onto the rankOptions list in
+// QueryEditor.tsx
+const (
+	RANK_CHANGES_COUNT   = iota
+	RANK_CHANGES_CLOSEST = iota
+)
+
+// Defaults and bounds for a search of what changed around an instant, the window is ± seconds
+const (
+	CHANGES_DEFAULT_WINDOW  = 60.0
+	CHANGES_MAX_WINDOW      = 3600.0
+	CHANGES_DEFAULT_LIMIT   = 100
+	CHANGES_MAX_LIMIT       = 1000
+	CHANGES_DEFAULT_TIMEOUT = 10 * time.Second
+	CHANGES_MAX_TIMEOUT     = 60 * time.Second
+)
+
+// keywordChanges summarises the changes of value of one keyword within the window around an instant, the distance
+// is to the closest change and first and last span all of its samples
+type keywordChanges struct {
+	Service  string    `json:"service"`
+	Keyword  string    `json:"keyword"`
+	Changes  int64     `json:"changes"`
+	Distance float64   `json:"distance"`
+	First    time.Time `json:"first"`
+	Last     time.Time `json:"last"`
+}
+
+// changesResult is what a search returns: the ranked keywords, and whether the timeout cut the scan short
+type changesResult struct {
+	Keywords []keywordChanges `json:"keywords"`
+	Partial  bool             `json:"partial"`
+}
+
+// resolveServices expands a comma separated list of services and glob patterns into service names.  An empty list
+// falls back on the services configured for the datasource, and failing that every service in the meta table.
+func resolveServices(db *sql.DB, config *DatasourceSettings, list string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		list = config.ChangeServices
+	}
+	if strings.TrimSpace(list) == "" {
+		list = "*"
+	}
+
+	seen := map[string]bool{}
+	services := []string{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || entry == EPHEM_SERVICE {
+			continue
+		}
+
+		matched := []string{entry}
+		if isServicePattern(entry) {
+			var err error
+			matched, err = matchServices(db, config, entry)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		for _, service := range matched {
+			if !seen[service] {
+				seen[service] = true
+				services = append(services, service)
+			}
+		}
+	}
+
+	return services, nil
+}
+
+// changeScan accumulates the samples of one service, ordered by keyword and time, into the changes of each keyword.
+// Each keyword's first sample is compared with the last one before the window, so a value that is only rebroadcast
+// isn't a change; keywords that didn't change at all are left out.
+type changeScan struct {
+	service  string
+	center   float64
+	current  *keywordChanges
+	previous sql.NullString
+	found    []keywordChanges
+}
+
+// add takes the next sample, prior is the keyword's last value before the window (invalid if it has none)
+func (c *changeScan) add(keyword string, t float64, value sql.NullString, prior sql.NullString) {
+	if c.current == nil || c.current.Keyword != keyword {
+		c.flush()
+		c.current = &keywordChanges{Service: c.service, Keyword: keyword, Distance: math.Inf(1), First: unixToTime(t)}
+		c.previous = prior
+	}
+
+	c.current.Last = unixToTime(t)
+	if value != c.previous {
+		c.current.Changes++
+		c.current.Distance = math.Min(c.current.Distance, math.Abs(t-c.center))
+	}
+	c.previous = value
+}
+
+// flush finishes the keyword in progress
+func (c *changeScan) flush() {
+	if c.current != nil && c.current.Changes > 0 {
+		c.found = append(c.found, *c.current)
+	}
+	c.current = nil
+}
+
+// findChanges scans the archive tables of the given services for keywords that changed value within ±window
+// seconds of an instant.  Each table is one query bounded by its time index, plus a probe per keyword for the value
+// it had going into the window.  Services without a table are skipped; when the context expires the scan stops and
+// what was found so far is returned marked as partial.
+func findChanges(ctx context.Context, db *sql.DB, services []string, at time.Time, window float64) (changesResult, error) {
+	result := changesResult{Keywords: []keywordChanges{}}
+	center := float64(at.UnixNano()) * 1e-9
+
+	for _, service := range services {
+		table := pq.QuoteIdentifier(service)
+		sql_changes := fmt.Sprintf(`with w as (
+				select keyword, time, trim(binvalue) as binvalue from %s where time >= $1 and time <= $2
+			), p as (
+				select k.keyword, b.binvalue from (select distinct keyword from w) k left join lateral (
+					select trim(a.binvalue) as binvalue from %s a where a.keyword = k.keyword and a.time < $1
+					order by a.time desc limit 1
+				) b on true
+			)
+			select w.keyword, w.time, w.binvalue, p.binvalue from w left join p on p.keyword = w.keyword
+			order by w.keyword, w.time;`, table, table)
+
+		rows, err := db.QueryContext(ctx, sql_changes, center-window, center+window)
+		if err != nil {
+			if ctx.Err() != nil {
+				result.Partial = true
+				return result, nil
+			}
+			if isUndefinedTable(err) {
+				log.DefaultLogger.Debug(fl() + "no archive table for service " + service)
+				continue
+			}
+			return result, err
+		}
+
+		scan := changeScan{service: service, center: center}
+		var keyword string
+		var sample_time float64
+		var value, prior sql.NullString
+		for rows.Next() {
+			err = rows.Scan(&keyword, &sample_time, &value, &prior)
+			if err != nil {
+				break
+			}
+			scan.add(keyword, sample_time, value, prior)
+		}
+		if err == nil {
+			err = rows.Err()
+		}
+		rows.Close()
+		scan.flush()
+		result.Keywords = append(result.Keywords, scan.found...)
+
+		if err != nil {
+			if ctx.Err() != nil {
+				result.Partial = true
+				return result, nil
+			}
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// rankChanges orders keywords by one of the RANK_CHANGES_* rankings and keeps at most limit of them.  Ties fall to
+// the other ranking and then to the name so the order is stable.
+func rankChanges(changes []keywordChanges, rank int, limit int) ([]keywordChanges, error) {
+	if rank != RANK_CHANGES_COUNT && rank != RANK_CHANGES_CLOSEST {
+		return nil, fmt.Errorf("Unknown ranking: %d", rank)
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		switch {
+		case rank == RANK_CHANGES_COUNT && a.Changes != b.Changes:
+			return a.Changes > b.Changes
+		case a.Distance != b.Distance:
+			return a.Distance < b.Distance
+		case a.Changes != b.Changes:
+			return a.Changes > b.Changes
+		case a.Service != b.Service:
+			return a.Service < b.Service
+		default:
+			return a.Keyword < b.Keyword
+		}
+	})
+
+	if limit > 0 && len(changes) > limit {
+		changes = changes[:limit]
+	}
+	return changes, nil
+}
+
+// changesLimits clamps the window, limit and timeout of a search to their bounds, zero picks the default
+func changesLimits(window float64, limit int, timeout time.Duration) (float64, int, time.Duration) {
+	if window <= 0 || math.IsNaN(window) {
+		window = CHANGES_DEFAULT_WINDOW
+	}
+	window = math.Min(window, CHANGES_MAX_WINDOW)
+
+	if limit <= 0 {
+		limit = CHANGES_DEFAULT_LIMIT
+	}
+	if limit > CHANGES_MAX_LIMIT {
+		limit = CHANGES_MAX_LIMIT
+	}
+
+	if timeout <= 0 {
+		timeout = CHANGES_DEFAULT_TIMEOUT
+	}
+	if timeout > CHANGES_MAX_TIMEOUT {
+		timeout = CHANGES_MAX_TIMEOUT
+	}
+
+	return window, limit, timeout
+}
+
+// searchChanges resolves the services, scans them within the timeout and ranks what it finds
+func searchChanges(ctx context.Context, db *sql.DB, config *DatasourceSettings, list string, at time.Time, window float64, rank int, limit int, timeout time.Duration) (changesResult, error) {
+	window, limit, timeout = changesLimits(window, limit, timeout)
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	services, err := resolveServices(db, config, list)
+	if err != nil {
+		return changesResult{}, err
+	}
+
+	result, err := findChanges(ctx, db, services, at, window)
+	if err != nil {
+		return result, err
+	}
+
+	result.Keywords, err = rankChanges(result.Keywords, rank, limit)
+	return result, err
+}
+
+// queryChanges lists the keywords, across the query's services or the configured set, that changed value within the
+// window around the query's instant, which defaults to the middle of the range
+func queryChanges(ctx context.Context, db *sql.DB, config *DatasourceSettings, query backend.DataQuery, qm queryModel) backend.DataResponse {
+	response := backend.DataResponse{}
+
+	middle := query.TimeRange.From.Add(query.TimeRange.To.Sub(query.TimeRange.From) / 2)
+	at, err := parseInstant(qm.At, middle)
+	if err != nil {
+		response.Error = err
+		return response
+	}
+
+	result, err := searchChanges(ctx, db, config, qm.Service, at, qm.Window, qm.Rank, qm.Limit, 0)
+	if err != nil {
+		log.DefaultLogger.Error(fl() + "changes search error: " + err.Error())
+		response.Error = err
+		return response
+	}
+
+	frame := changesFrame(result.Keywords)
+	frame.Name = "changes"
+	frame.RefID = qm.RefId
+	if result.Partial {
+		frame.AppendNotices(data.Notice{
+			Severity: data.NoticeSeverityWarning,
+			Text:     "The search timed out, only some services were scanned",
+		})
+	}
+
+	response.Frames = append(response.Frames, frame)
+	return response
+}
+
+// changesFrame builds the table of keywords that changed, one row each
+func changesFrame(changes []keywordChanges) *data.Frame {
+	services := make([]string, len(changes))
+	keywords := make([]string, len(changes))
+	counts := make([]int64, len(changes))
+	distances := make([]float64, len(changes))
+	firsts := make([]time.Time, len(changes))
+	lasts := make([]time.Time, len(changes))
+
+	for i, change := range changes {
+		services[i] = change.Service
+		keywords[i] = change.Keyword
+		counts[i] = change.Changes
+		distances[i] = change.Distance
+		firsts[i] = change.First
+		lasts[i] = change.Last
+	}
+
+	frame := data.NewFrame("changes",
+		data.NewField("service", nil, services),
+		data.NewField("keyword", nil, keywords),
+		data.NewField("changes", nil, counts),
+		data.NewField("closest", nil, distances).SetConfig(&data.FieldConfig{Unit: "s"}),
+		data.NewField("first", nil, firsts),
+		data.NewField("last", nil, lasts),
+	)
+	setFrameType(frame, data.FrameTypeTable)
+
+	return frame
+}
+
+// parseRank reads a ranking given by name in a resource call
+func parseRank(s string) (int, error) {
+	switch s {
+	case "", "count":
+		return RANK_CHANGES_COUNT, nil
+	case "closest", "closeness":
+		return RANK_CHANGES_CLOSEST, nil
+	default:
+		return 0, fmt.Errorf("unknown ranking: %q, expected count or closest", s)
+	}
+}
+
+// handleResourceChanges answers /changes?at=T&window=N&services=a,b*&rank=count|closest&limit=N&timeout=N, listing
+// the keywords sampled within ±window seconds of T
+func (ds *KeywordDatasource) handleResourceChanges(rw http.ResponseWriter, req *http.Request) {
+	params, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		writeError(rw, badRequest(err))
+		return
+	}
+
+	at, err := parseInstant(params.Get("at"), time.Now())
+	if err != nil {
+		writeError(rw, badRequest(err))
+		return
+	}
+	rank, err := parseRank(params.Get("rank"))
+	if err != nil {
+		writeError(rw, badRequest(err))
+		return
+	}
+
+	var window, timeout float64
+	var limit int
+	for name, target := range map[string]*float64{"window": &window, "timeout": &timeout} {
+		if s := params.Get(name); s != "" {
+			*target, err = strconv.ParseFloat(s, 64)
+			if err != nil {
+				writeError(rw, badRequest(fmt.Errorf("invalid %s: %q", name, s)))
+				return
+			}
+		}
+	}
+	if s := params.Get("limit"); s != "" {
+		limit, err = strconv.Atoi(s)
+		if err != nil {
+			writeError(rw, badRequest(fmt.Errorf("invalid limit: %q", s)))
+			return
+		}
+	}
+
+	cfg, db, err := openResourceDatabase(req)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	defer db.Close()
+
+	result, err := searchChanges(req.Context(), db, cfg, params.Get("services"), at, window, rank, limit, time.Duration(timeout*float64(time.Second)))
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+
+	writeResult(rw, result)
+}
@@ -0,0 +1,120 @@
+package plugin
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestRankChanges(t *testing.T) {
+	changes := func() []keywordChanges {
+		return []keywordChanges{
+			{Service: "dcs", Keyword: "AZ", Changes: 10, Distance: 5},
+			{Service: "dcs", Keyword: "EL", Changes: 10, Distance: 1},
+			{Service: "ao", Keyword: "LOOP", Changes: 1, Distance: 0.5},
+			{Service: "ao", Keyword: "GAIN", Changes: 1, Distance: 0.5},
+		}
+	}
+
+	cases := []struct {
+		rank     int
+		limit    int
+		expected []string
+	}{
+		{RANK_CHANGES_COUNT, 0, []string{"EL", "AZ", "GAIN", "LOOP"}},
+		{RANK_CHANGES_CLOSEST, 0, []string{"GAIN", "LOOP", "EL", "AZ"}},
+		{RANK_CHANGES_CLOSEST, 2, []string{"GAIN", "LOOP"}},
+	}
+
+	for i, c := range cases {
+		ranked, err := rankChanges(changes(), c.rank, c.limit)
+		if err != nil {
+			t.Fatalf("case %d: unexpected error %v", i, err)
+		}
+		if len(ranked) != len(c.expected) {
+			t.Fatalf("case %d: expected %d keywords, got %d", i, len(c.expected), len(ranked))
+		}
+		for j, keyword := range c.expected {
+			if ranked[j].Keyword != keyword {
+				t.Errorf("case %d: expected %s at %d, got %s", i, keyword, j, ranked[j].Keyword)
+			}
+		}
+	}
+
+	if _, err := rankChanges(changes(), 9, 0); err == nil {
+		t.Error("expected an error for an unknown ranking")
+	}
+}
+
+func TestChangesLimits(t *testing.T) {
+	window, limit, timeout := changesLimits(0, 0, 0)
+	if window != CHANGES_DEFAULT_WINDOW || limit != CHANGES_DEFAULT_LIMIT || timeout != CHANGES_DEFAULT_TIMEOUT {
+		t.Errorf("unexpected defaults %v %v %v", window, limit, timeout)
+	}
+
+	window, limit, timeout = changesLimits(1e6, 1e6, time.Hour)
+	if window != CHANGES_MAX_WINDOW || limit != CHANGES_MAX_LIMIT || timeout != CHANGES_MAX_TIMEOUT {
+		t.Errorf("unexpected bounds %v %v %v", window, limit, timeout)
+	}
+
+	window, limit, timeout = changesLimits(30, 5, time.Second)
+	if window != 30 || limit != 5 || timeout != time.Second {
+		t.Errorf("unexpected limits %v %v %v", window, limit, timeout)
+	}
+}
+
+func TestParseRank(t *testing.T) {
+	if rank, err := parseRank(""); err != nil || rank != RANK_CHANGES_COUNT {
+		t.Error("expected count ranking by default")
+	}
+	if rank, err := parseRank("closest"); err != nil || rank != RANK_CHANGES_CLOSEST {
+		t.Error("expected closest ranking")
+	}
+	if _, err := parseRank("random"); err == nil {
+		t.Error("expected an error for an unknown ranking")
+	}
+}
+
+func TestChangesFrame(t *testing.T) {
+	t0 := time.Unix(1700000000, 0).UTC()
+	frame := changesFrame([]keywordChanges{{Service: "dcs", Keyword: "AZ", Changes: 3, Distance: 2, First: t0, Last: t0.Add(time.Minute)}})
+
+	if frame.Rows() != 1 || len(frame.Fields) != 6 {
+		t.Fatalf("unexpected frame shape %d x %d", frame.Rows(), len(frame.Fields))
+	}
+	if frame.Fields[2].At(0).(int64) != 3 || frame.Fields[3].At(0).(float64) != 2 {
+		t.Error("unexpected changes or closest value")
+	}
+}
+
+func TestChangeScan(t *testing.T) {
+	text := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+	scan := changeScan{service: "dome", center: 100}
+
+	// Rebroadcast with the value it already had going into the window, never a change
+	scan.add("LIGHTS", 90, text("off"), text("off"))
+	scan.add("LIGHTS", 110, text("off"), text("off"))
+
+	// Changed from its prior value at 95 and back at 120
+	scan.add("SHUTTER", 80, text("Closed"), text("Closed"))
+	scan.add("SHUTTER", 95, text("Open"), text("Closed"))
+	scan.add("SHUTTER", 120, text("Closed"), text("Closed"))
+
+	// No sample before the window, so its first one is a change
+	scan.add("TEMP", 130, text("5"), sql.NullString{})
+	scan.flush()
+
+	if len(scan.found) != 2 || scan.found[0].Keyword != "SHUTTER" || scan.found[1].Keyword != "TEMP" {
+		t.Fatalf("expected SHUTTER and TEMP, got %v", scan.found)
+	}
+	shutter := scan.found[0]
+	if shutter.Changes != 2 || shutter.Distance != 5 || shutter.Service != "dome" {
+		t.Errorf("unexpected changes %+v", shutter)
+	}
+	if !shutter.First.Equal(unixToTime(80)) || !shutter.Last.Equal(unixToTime(120)) {
+		t.Errorf("unexpected span %s to %s", shutter.First, shutter.Last)
+	}
+	if scan.found[1].Changes != 1 || scan.found[1].Distance != 30 {
+		t.Errorf("unexpected changes %+v", scan.found[1])
+	}
+}
@@ -46,6 +46,14 @@ type DatasourceSettings struct {
 	Role      string `json:"role"`
 	Database  string `json:"database"`
 	MetaTable string `json:"metatable"`
+	EnumTable string `json:"enumtable"`
+
+	// Services scanned when searching for what changed around an instant, comma separated names or glob patterns
+	ChangeServices string `json:"changeservices"`
+
+	// Observatory site used by the computed ephem service, degrees with longitude positive east
+	Latitude  string `json:"latitude"`
+	Longitude string `json:"longitude"`
 }
 
 // Define the unit conversions, this maps onto the unitConversionOptions list in QueryEditor.tsx
@@ -66,8 +74,59 @@ const (
 	TRANSFORM_FIRST_DERIVATVE_10HZ  = iota
 	TRANSFORM_FIRST_DERIVATVE_100HZ = iota
 	TRANSFORM_DELTA                 = iota
+	TRANSFORM_UNWRAP                = iota
+	TRANSFORM_NORMALIZE             = iota
+)
+
+// Define the angle units used by the unwrap and normalize transforms, this maps onto the angleUnitOptions list in QueryEditor.tsx
+const (
+	ANGLE_UNITS_DEG = iota
+	ANGLE_UNITS_RAD = iota
+)
+
+// Define the normalize intervals, this maps onto the wrapIntervalOptions list in QueryEditor.tsx
+const (
+	WRAP_INTERVAL_POSITIVE = iota // [0, 360°) or [0, 2π)
+	WRAP_INTERVAL_SIGNED   = iota // [-180°, 180°) or [-π, π)
 )
 
+// Define the query modes, this maps onto the modeOptions list in QueryEditor.tsx
+const (
+	QUERY_MODE_TIME_SERIES  = iota
+	QUERY_MODE_ANNOTATIONS  = iota
+	QUERY_MODE_EVENTS       = iota
+	QUERY_MODE_DURATIONS    = iota
+	QUERY_MODE_INSTANT      = iota
+	QUERY_MODE_SNAPSHOT     = iota
+	QUERY_MODE_DIFF         = iota
+	QUERY_MODE_CHANGES      = iota
+	QUERY_MODE_AVAILABILITY = iota
+)
+
+// Define the string parse modes, this maps onto the parseOptions list in QueryEditor.tsx
+const (
+	PARSE_NONE                     = iota
+	PARSE_SEXAGESIMAL_HOURS_TO_DEG = iota
+	PARSE_SEXAGESIMAL_HOURS_TO_RAD = iota
+	PARSE_SEXAGESIMAL_DEG_TO_DEG   = iota
+	PARSE_SEXAGESIMAL_DEG_TO_RAD   = iota
+)
+
+// Define what happens to rows whose value can't be read, this maps onto the badRowOptions list in QueryEditor.tsx
+const (
+	BAD_ROWS_NULL = iota
+	BAD_ROWS_SKIP = iota
+)
+
+// The fraction of unreadable rows beyond which a query fails, unless the query sets its own
+const BAD_ROWS_DEFAULT_MAX_RATIO = 0.5
+
+// Upper bound on how many points are computed or bucketed across a query range
+const QUERY_MAX_POINTS = 10000
+
+// How many offending values are quoted in a frame notice
+const NOTICE_MAX_EXAMPLES = 5
+
 // LoadSettings gets the relevant settings from the plugin context
 func LoadSettings(ctx backend.PluginContext) (*DatasourceSettings, error) {
 	model := &DatasourceSettings{}
@@ -81,6 +140,14 @@ func LoadSettings(ctx backend.PluginContext) (*DatasourceSettings, error) {
 	return model, nil
 }
 
+// metaTable returns the quoted name of the keyword metadata table, ktlmeta unless configured otherwise
+func (config *DatasourceSettings) metaTable() string {
+	if config.MetaTable == "" {
+		return "ktlmeta"
+	}
+	return pq.QuoteIdentifier(config.MetaTable)
+}
+
 // NewDatasource creates a new datasource instance.
 func NewDatasource(_ context.Context, _ backend.DataSourceInstanceSettings) (instancemgmt.Instance, error) {
 
@@ -94,18 +161,25 @@ func NewDatasource(_ context.Context, _ backend.DataSourceInstanceSettings) (ins
 		im: im,
 	}
 
-	mux := http.NewServeMux()
-	httpResourceHandler := httpadapter.New(mux)
-
-	// Bind the HTTP paths to functions that respond to them
-	mux.HandleFunc("/services", ds.handleResourceKeywords)
-	mux.HandleFunc("/keywords", ds.handleResourceKeywords)
-
-	ds.CallResourceHandler = httpResourceHandler
+	ds.CallResourceHandler = httpadapter.New(ds.resourceMux())
 
 	return ds, nil
 }
 
+// resourceMux binds the HTTP paths to functions that respond to them, anything else is not found
+func (ds *KeywordDatasource) resourceMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/services", getOnly(ds.handleResourceServices))
+	mux.HandleFunc("/keywords", getOnly(ds.handleResourceKeywords))
+	mux.HandleFunc("/keyword", getOnly(ds.handleResourceKeyword))
+	mux.HandleFunc("/changes", getOnly(ds.handleResourceChanges))
+	mux.HandleFunc("/search", getOnly(ds.handleResourceSearch))
+	mux.HandleFunc("/availability", getOnly(ds.handleResourceAvailability))
+	mux.HandleFunc("/export", getOnly(ds.handleResourceExport))
+	mux.HandleFunc("/", handleResourceNotFound)
+	return mux
+}
+
 type KeywordDatasource struct {
 	// The instance manager can help with lifecycle management
 	// of datasource instances in plugins. It's not a requirements
@@ -144,7 +218,7 @@ func (ds *KeywordDatasource) QueryData(ctx context.Context, req *backend.QueryDa
 
 	// loop over queries and execute them individually.
 	for _, q := range req.Queries {
-		res := ds.query(ctx, q, db)
+		res := ds.query(ctx, q, db, config)
 
 		// save the response in a hashmap
 		// based on with RefID as identifier
@@ -157,18 +231,47 @@ func (ds *KeywordDatasource) QueryData(ctx context.Context, req *backend.QueryDa
 type queryModel struct {
 	//Datasource string `json:"datasource"`
 	//DatasourceId string `json:"datasourceId"`
-	Format         string `json:"format"`
-	QueryText      string `json:"queryText"`
-	UnitConversion int    `json:"unitConversion"`
-	Transform      int    `json:"transform"`
-	IntervalMs     int    `json:"intervalMs"`
-	MaxDataPoints  int    `json:"maxDataPoints"`
-	OrgId          int    `json:"orgId"`
-	RefId          string `json:"refId"`
-	Hide           bool   `json:"hide"`
+	Format           string   `json:"format"`
+	Mode             int      `json:"mode"`
+	QueryText        string   `json:"queryText"`
+	Service          string   `json:"service"`
+	At               string   `json:"at"`
+	Compare          string   `json:"compare"`
+	Window           float64  `json:"window"`
+	Rank             int      `json:"rank"`
+	Limit            int      `json:"limit"`
+	Bucket           string   `json:"bucket"`
+	UnitConversion   int      `json:"unitConversion"`
+	Transform        int      `json:"transform"`
+	Parse            int      `json:"parse"`
+	AngleUnits       int      `json:"angleUnits"`
+	WrapInterval     int      `json:"wrapInterval"`
+	UnwrapFirst      bool     `json:"unwrapFirst"`
+	EnumText         bool     `json:"enumText"`
+	DecodeBits       bool     `json:"decodeBits"`
+	Bits             string   `json:"bits"`
+	Elements         string   `json:"elements"`
+	ArrayHeatmap     bool     `json:"arrayHeatmap"`
+	TrueDuration     bool     `json:"trueDuration"`
+	BadRows          int      `json:"badRows"`
+	MaxBadRatio      *float64 `json:"maxBadRatio"`
+	Dedupe           bool     `json:"dedupe"`
+	DedupeTolerance  float64  `json:"dedupeTolerance"`
+	DedupeKeepLast   bool     `json:"dedupeKeepLast"`
+	AnnotationValues string   `json:"annotationValues"`
+	Condition        int      `json:"condition"`
+	Threshold        float64  `json:"threshold"`
+	ThresholdHigh    float64  `json:"thresholdHigh"`
+	Hysteresis       float64  `json:"hysteresis"`
+	MinDuration      float64  `json:"minDuration"`
+	IntervalMs       int      `json:"intervalMs"`
+	MaxDataPoints    int      `json:"maxDataPoints"`
+	OrgId            int      `json:"orgId"`
+	RefId            string   `json:"refId"`
+	Hide             bool     `json:"hide"`
 }
 
-func (ds *KeywordDatasource) query(ctx context.Context, query backend.DataQuery, db *sql.DB) backend.DataResponse {
+func (ds *KeywordDatasource) query(ctx context.Context, query backend.DataQuery, db *sql.DB, config *DatasourceSettings) backend.DataResponse {
 	// Unmarshal the json into our queryModel
 	var qm queryModel
 
@@ -189,6 +292,28 @@ func (ds *KeywordDatasource) query(ctx context.Context, query backend.DataQuery,
 	empty_frame := data.NewFrame("response")
 	empty_frame.Fields = append(empty_frame.Fields, data.NewField("time", nil, []time.Time{query.TimeRange.From, query.TimeRange.To}))
 
+	// A search for what changed spans services, the service field (if any) lists the ones to scan
+	if qm.Mode == QUERY_MODE_CHANGES {
+		return queryChanges(ctx, db, config, query, qm)
+	}
+
+	// Snapshots and diffs cover a whole service so they don't need a keyword, only the service (or for a diff a
+	// pattern of services)
+	if qm.Mode == QUERY_MODE_SNAPSHOT || qm.Mode == QUERY_MODE_DIFF {
+		service := qm.Service
+		if service == "" {
+			service, _, _ = strings.Cut(qm.QueryText, ".")
+		}
+		if service == "" || service == EPHEM_SERVICE {
+			response.Frames = append(response.Frames, empty_frame)
+			return response
+		}
+		if qm.Mode == QUERY_MODE_DIFF {
+			return queryDiff(db, config, query, qm, service)
+		}
+		return querySnapshot(db, config, query, qm, service)
+	}
+
 	// Return empty frame if query is empty
 	if qm.QueryText == "" {
 
@@ -207,13 +332,23 @@ func (ds *KeywordDatasource) query(ctx context.Context, query backend.DataQuery,
 	service := sk[0]
 	keyword := sk[1]
 
+	// Availability only counts samples, it doesn't need the keyword type or the values
+	if qm.Mode == QUERY_MODE_AVAILABILITY {
+		return queryAvailability(db, config, query, qm, service, keyword)
+	}
+
+	// The ephem service is computed here rather than being retrieved from the archive
+	if service == EPHEM_SERVICE {
+		return queryEphem(query, qm, keyword, config)
+	}
+
 	// Retrieve the values from the keyword archiver with Unix time as a floating point
 	from_u := float64(query.TimeRange.From.UnixNano()) * 1e-9
 	to_u := float64(query.TimeRange.To.UnixNano()) * 1e-9
 
 	// ----------------------------------------------------------------
 	// Determine the scalar type of the keyword
-	sql_type := fmt.Sprintf("select type from ktlmeta where service = $1 and keyword = $2 limit 1;")
+	sql_type := fmt.Sprintf("select type from %s where service = $1 and keyword = $2 limit 1;", config.metaTable())
 	row := db.QueryRow(sql_type, service, keyword)
 
 	var keyword_type string
@@ -236,6 +371,18 @@ func (ds *KeywordDatasource) query(ctx context.Context, query backend.DataQuery,
 		return response
 	}
 
+	// Threshold events need a number, which neither arrays nor booleans give
+	if qm.Mode == QUERY_MODE_EVENTS && (isArrayType(keyword_type) || isBooleanType(keyword_type)) {
+		response.Frames = append(response.Frames, empty_frame)
+		response.Error = fmt.Errorf("%s is %s, threshold events are not supported for this keyword type", qm.QueryText, keyword_type)
+		return response
+	}
+
+	// The instant mode only needs the latest sample, so skip the count and the range retrieval altogether
+	if qm.Mode == QUERY_MODE_INSTANT {
+		return queryInstant(db, config, query, qm, service, keyword, keyword_type)
+	}
+
 	// ----------------------------------------------------------------
 	// Build a SQL query for just counting
 	service = pq.QuoteIdentifier(service)
@@ -267,8 +414,8 @@ func (ds *KeywordDatasource) query(ctx context.Context, query backend.DataQuery,
 
 	// Setup and perform the query for the real data set now
 	// 2021-08-30: trim the binvalue so whitespace doesn't affect the float64 conversion below
-	sql := fmt.Sprintf("select time, trim(binvalue) from %s where keyword = $1 and time >= $2 and time <= $3 order by time asc;", service)
-	rows, err := db.Query(sql, keyword, from_u, to_u)
+	sql_data := fmt.Sprintf("select time, trim(binvalue) from %s where keyword = $1 and time >= $2 and time <= $3 order by time asc;", service)
+	rows, err := db.Query(sql_data, keyword, from_u, to_u)
 
 	if err != nil {
 		log.DefaultLogger.Error(fl() + "query retrieval error: " + err.Error())
@@ -278,158 +425,372 @@ func (ds *KeywordDatasource) query(ctx context.Context, query backend.DataQuery,
 	defer rows.Close()
 
 	// Store times and values here first
-	times := make([]time.Time, count)
-	values_floats := make([]float64, count)
-	values_strings := make([]string, count)
+	times := make([]time.Time, 0, count)
+	values_floats := make([]float64, 0, count)
+	values_strings := make([]string, 0, count)
+
+	// Bits are decoded from the archived text of numeric keywords, converting masks to floats would lose bits
+	var values_masks []string
+	if qm.DecodeBits && keyword_type != "KTL_STRING" {
+		values_masks = make([]string, 0, count)
+	}
+
+	// The archived text of every sample, only kept for the long table format which shows it
+	var raw_values rawTexts
+	if qm.Format == FORMAT_TABLE {
+		raw_values = make(rawTexts, count)
+	}
+
+	// Raw text of any numeric values that could not be read, these are nulled or skipped rather than failing the query
+	bad_values := []string{}
 
 	// Temporary variables for conversions/transforms
 	var timetemp float64
-	var valtemp_float, val float64
-	var valtemp_string string
+	var valtemp sql.NullString
 	var i int32
 
+	// Strings, arrays and booleans are all kept as text, and the latter two are parsed afterwards
+	scan_string := keyword_type == "KTL_STRING" || isArrayType(keyword_type) || isBooleanType(keyword_type)
+
 	// Iterate only as many rows as predicted, it's possible more rows arrived after the initial query executed!
-	for i = 0; i < count; i++ {
+	for i = 0; i < count && rows.Next(); i++ {
 
-		// Get the next row
-		if rows.Next() {
+		// Everything is scanned as text, numbers are parsed below so one bad row can't spoil the whole query
+		err = rows.Scan(&timetemp, &valtemp)
 
-			// Pull the value out of the row, separate arrays for floats and strings
-			if keyword_type == "KTL_STRING" {
-				err = rows.Scan(&timetemp, &valtemp_string)
-			} else {
-				err = rows.Scan(&timetemp, &valtemp_float)
-			}
+		// This error may result when the time itself cannot be converted
+		if err != nil {
+			log.DefaultLogger.Error(fl() + "query scan error: " + err.Error())
 
-			// This error may result when it cannot be converted to either a float or a string
-			if err != nil {
-				log.DefaultLogger.Error(fl() + "query scan error: " + err.Error())
+			// Send back an empty frame, the query failed in some way
+			response.Frames = append(response.Frames, empty_frame)
+			response.Error = err
+			return response
+		}
+
+		timestamp := unixToTime(timetemp)
+
+		if raw_values != nil {
+			raw_values.add(timestamp, rawValue(valtemp))
+		}
 
-				// Send back an empty frame, the query failed in some way with both floats and strings
+		// Assign the value to the result array, a null string is just an empty one
+		if scan_string {
+			times = append(times, timestamp)
+			values_strings = append(values_strings, valtemp.String)
+			continue
+		}
+
+		val, ok := parseNumber(valtemp)
+		if !ok {
+			bad_values = append(bad_values, rawValue(valtemp))
+			if qm.BadRows == BAD_ROWS_SKIP {
+				continue
+			}
+			// NaN stands in for null until the frame is built
+			val = math.NaN()
+		} else {
+			// If we are doing a unit conversion, perform it now while we have the single value in hand
+			val, err = convertUnits(val, qm.UnitConversion)
+			if err != nil {
+				// Send back an empty frame with an error, we did not understand the conversion
 				response.Frames = append(response.Frames, empty_frame)
 				response.Error = err
 				return response
 			}
 		}
 
-		// Separate the fractional seconds so we can convert it into a time.Time
-		sec, dec := math.Modf(timetemp)
-		times[i] = time.Unix(int64(sec), int64(dec*(1e9)))
+		times = append(times, timestamp)
+		values_floats = append(values_floats, val)
+		if values_masks != nil {
+			values_masks = append(values_masks, valtemp.String)
+		}
+	}
 
-		// Assign the value to the result array
-		if keyword_type == "KTL_STRING" {
+	// Get any error encountered during iteration of the SQL result
+	err = rows.Err()
+	if err != nil {
+		log.DefaultLogger.Error(fl() + "query row error: " + err.Error())
+		response.Error = fmt.Errorf("row query error: %s", err.Error())
+	}
+
+	// Notices to attach to the frame, for problems that don't warrant failing the query
+	var notices []data.Notice
 
-			values_strings[i] = valtemp_string
+	// Too many unreadable values means something is wrong with the keyword rather than with a few rows
+	if len(bad_values) > 0 {
+		log.DefaultLogger.Warn(fl() + fmt.Sprintf("%s: %d of %d values could not be read", qm.QueryText, len(bad_values), i))
+		err = checkBadRows(len(bad_values), int(i), qm.MaxBadRatio)
+		if err != nil {
+			response.Frames = append(response.Frames, empty_frame)
+			response.Error = err
+			return response
+		}
+		notices = append(notices, badValuesNotice("could not be read as numbers", len(bad_values), int(i), bad_values))
+	}
 
+	// Drop consecutive repeats, exact for anything kept as text and within the tolerance for numbers
+	if qm.Dedupe {
+		if scan_string {
+			times, values_strings = dedupeStrings(times, values_strings, qm.DedupeKeepLast)
 		} else {
-			// If we are doing a unit conversion, perform it now while we have the single value in hand
-			switch qm.UnitConversion {
+			kept := dedupeFloatIndices(values_floats, qm.DedupeTolerance, qm.DedupeKeepLast)
+			times, values_floats = pickIndices(times, kept), pickIndices(values_floats, kept)
+			if values_masks != nil {
+				values_masks = pickIndices(values_masks, kept)
+			}
+		}
+	}
 
-			case UNIT_CONVERT_NONE:
-				// No conversion, just assign it straight over
-				val = valtemp_float
+	// Transition annotations and state durations both work from the value as text, so they cover any kind of keyword
+	if qm.Mode == QUERY_MODE_ANNOTATIONS || qm.Mode == QUERY_MODE_DURATIONS {
+		var enumerators map[int64]string
+		if isEnumType(keyword_type) {
+			enumerators, err = loadEnumerators(db, config, sk[0], keyword)
+			if err != nil {
+				log.DefaultLogger.Warn(fl() + "enumerator retrieval error: " + err.Error())
+			}
+		}
 
-			case UNIT_CONVERT_DEG_TO_RAD:
-				// RAD = DEG * π/180  (1° = 0.01745rad)
-				val = valtemp_float * (math.Pi / 180)
+		// The value in force at the start of the range comes from the last sample before it, for durations it fills the
+		// start of the range and for annotations it is what the first change in the range is a change from
+		_, prior, found, err := latestSample(db, service, keyword, from_u, false)
+		if err != nil {
+			log.DefaultLogger.Warn(fl() + "prior sample retrieval error: " + err.Error())
+			notices = append(notices, data.Notice{Severity: data.NoticeSeverityWarning, Text: "value at the start of the range unavailable: " + err.Error()})
+		} else if found {
+			times, values_strings, values_floats = prependPrior(times, values_strings, values_floats, scan_string, query.TimeRange.From, prior, qm.UnitConversion)
+		}
+
+		ttimes, texts := keywordTexts(keyword_type, times, values_strings, values_floats, enumerators)
 
-			case UNIT_CONVERT_RAD_TO_DEG:
-				// DEG = RAD * 180/π  (1rad = 57.296°)
-				val = valtemp_float * (180 / math.Pi)
+		var frame *data.Frame
+		if qm.Mode == QUERY_MODE_ANNOTATIONS {
+			frame = transitionAnnotations(ttimes, texts, query.TimeRange.To, sk[0], keyword, parseValueFilter(qm.AnnotationValues))
+		} else {
+			durations := stateDurations(ttimes, texts, query.TimeRange.From, query.TimeRange.To)
+			frame = durationsFrame(durations, query.TimeRange.To.Sub(query.TimeRange.From))
+			frame.Name = qm.QueryText
+		}
+		frame.RefID = qm.RefId
+		if len(notices) > 0 {
+			frame.AppendNotices(notices...)
+		}
+
+		response.Frames = append(response.Frames, frame)
+		return response
+	}
 
-			case UNIT_CONVERT_RAD_TO_ARCSEC:
-				// ARCSEC = RAD * (3600 * 180)/π  (1rad = 206264.806")
-				val = valtemp_float * (3600 * 180 / math.Pi)
+	// Array keywords become one field per element, or a heatmap of element index against time
+	if isArrayType(keyword_type) {
+		atimes, arrays, failures, err := parseArrays(times, values_strings, qm.UnitConversion, qm.BadRows != BAD_ROWS_SKIP)
+		if err != nil {
+			// Send back an empty frame with an error, we did not understand the conversion
+			response.Frames = append(response.Frames, empty_frame)
+			response.Error = err
+			return response
+		}
 
-			case UNIT_CONVERT_K_TO_C:
-				// °C = K + 273.15
-				val = valtemp_float + 273.15
+		selected, err := arrayElements(arrays, qm.Elements)
+		if err != nil {
+			// Send back an empty frame with an error, we did not understand the element selection
+			response.Frames = append(response.Frames, empty_frame)
+			response.Error = err
+			return response
+		}
 
-			case UNIT_CONVERT_C_TO_K:
-				// K = °C − 273.15
-				val = valtemp_float - 273.15
+		var frame *data.Frame
+		if qm.ArrayHeatmap {
+			frame = arrayHeatmapFrame(atimes, arrays, selected)
+		} else {
+			frame = data.NewFrame("response")
+			frame.Fields = append(frame.Fields, arrayFields(arrays, selected)...)
+			frame.Fields = append(frame.Fields, data.NewField("time", nil, atimes))
+		}
+		frame.RefID = qm.RefId
+		frame.Name = qm.QueryText
 
-			default:
-				// Send back an empty frame with an error, we did not understand the conversion
+		if len(failures) > 0 {
+			log.DefaultLogger.Warn(fl() + fmt.Sprintf("%s: %d arrays could not be parsed", qm.QueryText, len(failures)))
+			err = checkBadRows(len(failures), len(values_strings), qm.MaxBadRatio)
+			if err != nil {
 				response.Frames = append(response.Frames, empty_frame)
-				response.Error = fmt.Errorf("Unknown unit conversion: %d", qm.UnitConversion)
+				response.Error = err
 				return response
 			}
+			frame.AppendNotices(badValuesNotice("could not be parsed", len(failures), len(values_strings), failures))
+		}
+
+		return formattedResponse(response, frame, query, qm, sk[0], keyword, raw_values)
+	}
+
+	// Booleans are normalized from their various textual forms into a bool field for state timelines
+	if isBooleanType(keyword_type) {
+		btimes, bvalues, failures := parseBooleans(times, values_strings, qm.BadRows != BAD_ROWS_SKIP)
+
+		frame := data.NewFrame("response")
+		frame.RefID = qm.RefId
+		frame.Name = qm.QueryText
+		frame.Fields = append(frame.Fields, data.NewField("", nil, bvalues))
+		frame.Fields = append(frame.Fields, data.NewField("time", nil, btimes))
+
+		// Optionally report how long the keyword was true, in seconds.  The last sample before the range says whether
+		// it was already true at the start.
+		if qm.TrueDuration {
+			dtimes, dvalues := btimes, bvalues
+			ptime, prior, found, err := latestSample(db, service, keyword, from_u, false)
+			if err == nil && found {
+				ptimes, pvalues, _ := parseBooleans([]time.Time{ptime}, []string{prior.String}, false)
+				dtimes, dvalues = append(ptimes, btimes...), append(pvalues, bvalues...)
+			}
 
-			values_floats[i] = val
+			frame.SetMeta(&data.FrameMeta{Custom: map[string]interface{}{
+				"trueDuration": trueDuration(dtimes, dvalues, query.TimeRange.From, query.TimeRange.To).Seconds(),
+			}})
+			if err != nil {
+				log.DefaultLogger.Warn(fl() + "prior sample retrieval error: " + err.Error())
+				frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: "value at the start of the range unavailable: " + err.Error()})
+			}
 		}
 
+		if len(failures) > 0 {
+			log.DefaultLogger.Warn(fl() + fmt.Sprintf("%s: %d booleans could not be parsed", qm.QueryText, len(failures)))
+			err = checkBadRows(len(failures), len(values_strings), qm.MaxBadRatio)
+			if err != nil {
+				response.Frames = append(response.Frames, empty_frame)
+				response.Error = err
+				return response
+			}
+			frame.AppendNotices(badValuesNotice("could not be parsed", len(failures), len(values_strings), failures))
+		}
+
+		return formattedResponse(response, frame, query, qm, sk[0], keyword, raw_values)
 	}
 
-	// Perform any requested data transforms
-	switch qm.Transform {
+	// Parse sexagesimal strings into angles, from here on the keyword is treated as numeric
+	is_string := keyword_type == "KTL_STRING"
+	if is_string && qm.Parse != PARSE_NONE {
+		var failures []string
+		times, values_floats, failures, err = parseAngles(times, values_strings, qm.Parse, qm.BadRows != BAD_ROWS_SKIP)
+		if err != nil {
+			// Send back an empty frame with an error, we did not understand the parse mode
+			response.Frames = append(response.Frames, empty_frame)
+			response.Error = err
+			return response
+		}
 
-	case TRANSFORM_NONE:
-		break
+		// The unit conversion is applied to the parsed angles just as it would be to a numeric keyword
+		for j := range values_floats {
+			values_floats[j], err = convertUnits(values_floats[j], qm.UnitConversion)
+			if err != nil {
+				response.Frames = append(response.Frames, empty_frame)
+				response.Error = err
+				return response
+			}
+		}
 
-	case TRANSFORM_FIRST_DERIVATVE, TRANSFORM_FIRST_DERIVATVE_1HZ, TRANSFORM_FIRST_DERIVATVE_10HZ, TRANSFORM_FIRST_DERIVATVE_100HZ:
+		if len(failures) > 0 {
+			log.DefaultLogger.Warn(fl() + fmt.Sprintf("%s: %d values could not be parsed", qm.QueryText, len(failures)))
+			err = checkBadRows(len(failures), len(values_strings), qm.MaxBadRatio)
+			if err != nil {
+				response.Frames = append(response.Frames, empty_frame)
+				response.Error = err
+				return response
+			}
+			notices = append(notices, badValuesNotice("could not be parsed", len(failures), len(values_strings), failures))
+		}
 
-		// Compute the first derivative of the data.
-		dtimes := make([]time.Time, count-1)
-		dvalues := make([]float64, count-1)
+		is_string = false
+	}
 
-		for i = 1; i < count; i++ {
-			// Calculate the dt
-			dtimes[i-1] = times[i]
+	// Split a mask or status word into one boolean field per bit, this takes the place of the single value field
+	if qm.DecodeBits && !is_string {
+		if values_masks == nil {
+			response.Frames = append(response.Frames, empty_frame)
+			response.Error = fmt.Errorf("%s is a string, bits can only be decoded from an integer keyword", qm.QueryText)
+			return response
+		}
+		masks := parseMasks(values_masks)
 
-			// Calculate the dy/dt
-			var dt, dvdt float64
-			dt = (times[i].Sub(times[i-1])).Seconds()
-			dvdt = (values_floats[i] - values_floats[i-1]) / dt
+		var names map[int64]string
+		if keyword_type == "KTL_MASK" {
+			names, err = loadEnumerators(db, config, sk[0], keyword)
+			if err != nil {
+				log.DefaultLogger.Warn(fl() + "bit name retrieval error: " + err.Error())
+				notices = append(notices, data.Notice{Severity: data.NoticeSeverityWarning, Text: "bit names unavailable: " + err.Error()})
+				names = nil
+			}
+		}
 
-			if qm.Transform == TRANSFORM_FIRST_DERIVATVE_1HZ {
-				dvdt = math.Round(dvdt)
-			} else if qm.Transform == TRANSFORM_FIRST_DERIVATVE_10HZ {
-				dvdt = math.Round(dvdt*10) / 10
-			} else if qm.Transform == TRANSFORM_FIRST_DERIVATVE_100HZ {
-				dvdt = math.Round(dvdt*100) / 100
+		selected := maskBits(masks, names)
+		if qm.Bits != "" {
+			selected, err = parseBitList(qm.Bits)
+			if err != nil {
+				response.Frames = append(response.Frames, empty_frame)
+				response.Error = err
+				return response
 			}
+		}
 
-			dvalues[i-1] = dvdt
+		frame := data.NewFrame("response")
+		frame.RefID = qm.RefId
+		frame.Name = qm.QueryText
+		frame.Fields = append(frame.Fields, decodeBitmask(masks, selected, names)...)
+		frame.Fields = append(frame.Fields, data.NewField("time", nil, times))
+		if len(notices) > 0 {
+			frame.AppendNotices(notices...)
 		}
 
-		// Reassign the original arrays to be the 1st derivative results
-		times = dtimes
-		values_floats = dvalues
+		return formattedResponse(response, frame, query, qm, sk[0], keyword, raw_values)
+	}
 
-	case TRANSFORM_DELTA:
-		// Compute the deltas of the data.  This algorithm replicates what numpy diff() does in Python,
-		// to the extent that it disregards the time series data.  The resultant arrays have one fewer element,
-		// we drop the 0th element of time and value.  It's like a first derivative where dt is always 1.
-		// See https://numpy.org/doc/stable/reference/generated/numpy.diff.html
-		dtimes := make([]time.Time, count-1)
-		dvalues := make([]float64, count-1)
+	// Perform any requested data transforms, these only make sense for numeric values
+	if !is_string {
+		times, values_floats, err = transformValues(times, values_floats, qm)
+		if err != nil {
+			// Send back an empty frame with an error, we did not understand the transform
+			response.Frames = append(response.Frames, empty_frame)
+			response.Error = err
+			return response
+		}
+	}
 
-		for i = 1; i < count; i++ {
-			// Bring the time val straight across, shifted by one
-			dtimes[i-1] = times[i]
+	// Find the intervals where the (possibly transformed) value met the condition
+	if qm.Mode == QUERY_MODE_EVENTS {
+		if is_string {
+			response.Frames = append(response.Frames, empty_frame)
+			response.Error = fmt.Errorf("%s is not numeric, threshold events need a number", qm.QueryText)
+			return response
+		}
 
-			// Calculate the dx/dt and assume dt is always 1
-			dvalues[i-1] = values_floats[i] - values_floats[i-1]
+		condition, err := newEventCondition(qm)
+		if err != nil {
+			response.Frames = append(response.Frames, empty_frame)
+			response.Error = err
+			return response
 		}
 
-		// Reassign the original arrays to be the new results
-		times = dtimes
-		values_floats = dvalues
+		min_duration := time.Duration(qm.MinDuration * float64(time.Second))
+		frame := eventsFrame(findEvents(times, values_floats, condition, query.TimeRange.To, min_duration), sk[0], keyword)
+		frame.RefID = qm.RefId
+		if len(notices) > 0 {
+			frame.AppendNotices(notices...)
+		}
 
-	default:
-		// Send back an empty frame with an error, we did not understand the transform
-		response.Frames = append(response.Frames, empty_frame)
-		response.Error = fmt.Errorf("Unknown transform: %d", qm.Transform)
+		response.Frames = append(response.Frames, frame)
 		return response
-
 	}
 
-	// Get any error encountered during iteration of the SQL result
-	err = rows.Err()
-	if err != nil {
-		log.DefaultLogger.Error(fl() + "query row error: " + err.Error())
-		response.Error = fmt.Errorf("row query error: " + err.Error())
+	// Enumerated keywords carry their labels, either as value mappings on the numbers or in place of them.
+	// A transformed series is no longer made of enumerator values so it is left alone.
+	var enumerators map[int64]string
+	if isEnumType(keyword_type) && qm.Transform == TRANSFORM_NONE {
+		enumerators, err = loadEnumerators(db, config, sk[0], keyword)
+		if err != nil {
+			log.DefaultLogger.Warn(fl() + "enumerator retrieval error: " + err.Error())
+			notices = append(notices, data.Notice{Severity: data.NoticeSeverityWarning, Text: "enumerators unavailable: " + err.Error()})
+			enumerators = nil
+		}
 	}
 
 	// Start a new frame and add the times + values
@@ -441,17 +802,61 @@ func (ds *KeywordDatasource) query(ctx context.Context, query backend.DataQuery,
 	// .Name field above (thus creating a series named "service.KEYWORD values" which may not be the desired
 	// name for the series.  Thus, submit it with an empty string for now which appears to work.
 	//frame.Fields = append(frame.Fields, data.NewField("values", nil, values))
-	if keyword_type == "KTL_STRING" {
+	if is_string {
 		frame.Fields = append(frame.Fields, data.NewField("", nil, values_strings))
+	} else if enumerators != nil && qm.EnumText {
+		frame.Fields = append(frame.Fields, data.NewField("", nil, enumLabels(values_floats, enumerators)))
 	} else {
-		frame.Fields = append(frame.Fields, data.NewField("", nil, values_floats))
+		field := floatField("", values_floats)
+		if len(enumerators) > 0 {
+			field.Config = &data.FieldConfig{Mappings: enumMappings(enumerators)}
+		}
+		frame.Fields = append(frame.Fields, field)
 	}
 	frame.Fields = append(frame.Fields, data.NewField("time", nil, times))
 
-	// add the frames to the response
-	response.Frames = append(response.Frames, frame)
+	if len(notices) > 0 {
+		frame.AppendNotices(notices...)
+	}
+
+	// add the frames to the response, in the requested format
+	return formattedResponse(response, frame, query, qm, sk[0], keyword, raw_values)
+}
+
+// badValuesNotice builds a warning for values that were left out of a result, quoting the first few of them
+func badValuesNotice(reason string, count int, total int, examples []string) data.Notice {
+	if len(examples) > NOTICE_MAX_EXAMPLES {
+		examples = examples[:NOTICE_MAX_EXAMPLES]
+	}
+
+	quoted := make([]string, len(examples))
+	for i, example := range examples {
+		quoted[i] = fmt.Sprintf("%q", example)
+	}
+
+	return data.Notice{
+		Severity: data.NoticeSeverityWarning,
+		Text:     fmt.Sprintf("%d of %d values %s, e.g. %s", count, total, reason, strings.Join(quoted, ", ")),
+	}
+}
+
+// queryStep picks a sampling or bucket interval for a query: the panel interval, but never so small that there
+// would be more than maxPoints steps across the range (or than the panel asked for), and at least a second
+func queryStep(query backend.DataQuery, maxPoints int64) time.Duration {
+	span := query.TimeRange.To.Sub(query.TimeRange.From)
+	if query.MaxDataPoints > 0 && query.MaxDataPoints < maxPoints {
+		maxPoints = query.MaxDataPoints
+	}
+
+	step := query.Interval
+	if minStep := span / time.Duration(maxPoints); step < minStep {
+		step = minStep
+	}
+	if step < time.Second {
+		step = time.Second
+	}
 
-	return response
+	return step
 }
 
 // CheckHealth handles health checks sent from Grafana to the plugin.
@@ -504,42 +909,13 @@ func (ds *KeywordDatasource) CheckHealth(ctx context.Context, req *backend.Check
 	}, nil
 }
 
-func writeResult(rw http.ResponseWriter, path string, val interface{}, err error) {
-	response := make(map[string]interface{})
-	code := http.StatusOK
-	if err != nil {
-		response["error"] = err.Error()
-		code = http.StatusBadRequest
-	} else {
-		response[path] = val
-	}
-
-	body, err := json.Marshal(response)
-	if err != nil {
-		body = []byte(err.Error())
-		code = http.StatusInternalServerError
-	}
-	_, err = rw.Write(body)
-	if err != nil {
-		code = http.StatusInternalServerError
-	}
-	rw.WriteHeader(code)
-}
-
-func (ds *KeywordDatasource) handleResourceKeywords(rw http.ResponseWriter, req *http.Request) {
-	log.DefaultLogger.Debug(fl() + "resource call url=" + req.URL.String() + "  method=" + req.Method)
-
-	if req.Method != http.MethodGet {
-		return
-	}
-
-	// Get the configuration
-	ctx := req.Context()
-	cfg, err := LoadSettings(httpadapter.PluginConfigFromContext(ctx))
+// openResourceDatabase loads the settings of the datasource behind a resource call and opens its database, the
+// caller closes it
+func openResourceDatabase(req *http.Request) (*DatasourceSettings, *sql.DB, error) {
+	cfg, err := LoadSettings(httpadapter.PluginConfigFromContext(req.Context()))
 	if err != nil {
 		log.DefaultLogger.Error(fl() + "settings load error")
-		writeResult(rw, "?", nil, err)
-		return
+		return nil, nil, err
 	}
 
 	// Build the connection string
@@ -549,102 +925,125 @@ func (ds *KeywordDatasource) handleResourceKeywords(rw http.ResponseWriter, req
 	db, err := sql.Open("postgres", psqlInfo)
 	if err != nil {
 		log.DefaultLogger.Error(fl() + "DB connection error")
-		writeResult(rw, "?", nil, err)
+		return nil, nil, err
+	}
+
+	return cfg, db, nil
+}
+
+// handleResourceServices answers /services with the services in order, the computed ephem service among them
+func (ds *KeywordDatasource) handleResourceServices(rw http.ResponseWriter, req *http.Request) {
+	cfg, db, err := openResourceDatabase(req)
+	if err != nil {
+		writeError(rw, err)
 		return
 	}
 	defer db.Close()
 
-	// Retrieve the keywords for a given service
-	if strings.HasPrefix(req.URL.String(), "/keywords") {
-
-		// The only parameter expected to come in is the one indicating for which service to retrieve the keywords
-		params, err := url.ParseQuery(req.URL.RawQuery)
-		if err != nil {
-			log.DefaultLogger.Error(fl() + "keywords URL error: " + err.Error())
-			writeResult(rw, "?", nil, err)
-			return
-		}
-		service := params.Get("service")
+	// Retrieve the services, all of them, 106 on 2020-06-09
+	sqlStatement := fmt.Sprintf("select distinct service from %s order by service asc;", cfg.metaTable())
+	rows, err := db.Query(sqlStatement)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	defer rows.Close()
 
-		sqlStatement := "select keyword from ktlmeta where service = $1 order by keyword asc;"
-		rows, err := db.Query(sqlStatement, service)
+	// Prepare a container to send back to the caller, the value and the label are both the service name
+	services := []resourceOption{}
+	ephem := resourceOption{Value: EPHEM_SERVICE, Label: EPHEM_SERVICE}
 
+	var service string
+	for rows.Next() {
+		err = rows.Scan(&service)
 		if err != nil {
-			log.DefaultLogger.Error(fl() + "keywords retrieval failure")
-			writeResult(rw, "?", nil, err)
+			writeError(rw, err)
+			return
 		}
-		defer rows.Close()
 
-		// Prepare a container to send back to the caller
-		keywords := map[string]string{}
-
-		// Iterate the service list and add to the return array
-		var keyword string
-		for rows.Next() {
-			err = rows.Scan(&keyword)
-			if err != nil {
-				log.DefaultLogger.Error(fl() + "keywords scan error")
-				writeResult(rw, "?", nil, err)
-			}
-
-			// Make a key-value pair for Grafana to use, the key is the bare keyword name and the service.keyword is the display value
-			keywords[keyword] = service + "." + keyword
+		// Slot the computed ephem service in among the archived ones
+		if ephem.Value != "" && service > EPHEM_SERVICE {
+			services = append(services, ephem)
+			ephem.Value = ""
 		}
+		services = append(services, resourceOption{Value: service, Label: service})
+	}
 
-		// get any error encountered during iteration
-		err = rows.Err()
-		if err != nil {
-			log.DefaultLogger.Error(fl() + "services row error")
-			writeResult(rw, "?", nil, err)
-		}
+	// get any error encountered during iteration
+	if err = rows.Err(); err != nil {
+		writeError(rw, err)
+		return
+	}
+	if ephem.Value != "" {
+		services = append(services, ephem)
+	}
 
-		writeResult(rw, "keywords", keywords, err)
+	writeResult(rw, services)
+}
 
-		// Retrieve the services list
-	} else if strings.HasPrefix(req.URL.String(), "/services") {
+// handleResourceKeywords answers /keywords?service=S with the service's keywords in order, the value is the bare
+// keyword name and the label is service.keyword
+func (ds *KeywordDatasource) handleResourceKeywords(rw http.ResponseWriter, req *http.Request) {
 
-		// Retrieve the services, all of them, 106 on 2020-06-09
-		sqlStatement := "select distinct service from ktlmeta order by service ASC;"
-		rows, err := db.Query(sqlStatement)
+	// The only parameter expected to come in is the one indicating for which service to retrieve the keywords
+	params, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		writeError(rw, badRequest(err))
+		return
+	}
+	service := params.Get("service")
+	if service == "" {
+		writeError(rw, badRequest(fmt.Errorf("expected a service parameter")))
+		return
+	}
 
-		if err != nil {
-			log.DefaultLogger.Error(fl() + "services count error")
-			writeResult(rw, "?", nil, err)
-		}
-		defer rows.Close()
+	// The computed ephem service has no entries in the meta table
+	if service == EPHEM_SERVICE {
+		writeResult(rw, ephemKeywordOptions())
+		return
+	}
 
-		// Prepare a container to send back to the caller
-		services := map[string]string{}
+	cfg, db, err := openResourceDatabase(req)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	defer db.Close()
 
-		// Iterate the service list and add to the return array
-		var service string
-		for rows.Next() {
-			err = rows.Scan(&service)
-			if err != nil {
-				log.DefaultLogger.Error(fl() + "services scan error")
-				writeResult(rw, "?", nil, err)
-			}
+	sqlStatement := fmt.Sprintf("select keyword from %s where service = $1 order by keyword asc;", cfg.metaTable())
+	rows, err := db.Query(sqlStatement, service)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	defer rows.Close()
 
-			// Make a key-value pair for Grafana to use but the key and the value end up being the same (is this lazy?)
-			services[service] = service
-		}
+	// Prepare a container to send back to the caller
+	keywords := []resourceOption{}
 
-		// get any error encountered during iteration
-		err = rows.Err()
+	var keyword string
+	for rows.Next() {
+		err = rows.Scan(&keyword)
 		if err != nil {
-			log.DefaultLogger.Error(fl() + "services row error")
-			writeResult(rw, "?", nil, err)
+			writeError(rw, err)
+			return
 		}
+		keywords = append(keywords, resourceOption{Value: keyword, Label: service + "." + keyword})
+	}
 
-		writeResult(rw, "services", services, err)
-
-	} else {
+	// get any error encountered during iteration
+	if err = rows.Err(); err != nil {
+		writeError(rw, err)
+		return
+	}
 
-		// If we got this far, it was a bogus request
-		log.DefaultLogger.Error(fl() + "invalid request string")
-		writeResult(rw, "?", nil, err)
+	// A service without any keywords isn't one the archive knows about
+	if len(keywords) == 0 {
+		writeError(rw, notFound(fmt.Errorf("unknown service: %s", service)))
+		return
 	}
 
+	writeResult(rw, keywords)
 }
 
 type instanceSettings struct {
@@ -8,11 +8,14 @@ import (
 )
 
 func TestQueryData(t *testing.T) {
-	ds := Datasource{}
+	ds := KeywordDatasource{}
 
 	resp, err := ds.QueryData(
 		context.Background(),
 		&backend.QueryDataRequest{
+			PluginContext: backend.PluginContext{
+				DataSourceInstanceSettings: &backend.DataSourceInstanceSettings{JSONData: []byte(`{}`)},
+			},
 			Queries: []backend.DataQuery{
 				{RefID: "A"},
 			},
@@ -0,0 +1,67 @@
+package plugin
+
+import (
+	"math"
+	"time"
+)
+
+// dedupeFloats keeps only the samples that differ from the last one kept by more than the tolerance.  Comparing
+// against the last kept sample rather than the previous one stops a slow drift from being dropped entirely.
+// Runs of NaN (unreadable rows) count as repeats of each other.  With keepLast the final sample is always kept
+// so the series extends to the end of the data.
+func dedupeFloats(times []time.Time, values []float64, tolerance float64, keepLast bool) ([]time.Time, []float64) {
+	kept := dedupeFloatIndices(values, tolerance, keepLast)
+	return pickIndices(times, kept), pickIndices(values, kept)
+}
+
+// dedupeFloatIndices is dedupeFloats giving the indices of the samples kept, so anything else held alongside the
+// values can be thinned to match
+func dedupeFloatIndices(values []float64, tolerance float64, keepLast bool) []int {
+	kept := []int{}
+	for i := range values {
+		if i == 0 {
+			kept = append(kept, i)
+			continue
+		}
+		last := values[kept[len(kept)-1]]
+
+		same := math.Abs(values[i]-last) <= tolerance
+		if math.IsNaN(values[i]) || math.IsNaN(last) {
+			same = math.IsNaN(values[i]) && math.IsNaN(last)
+		}
+
+		if !same || (keepLast && i == len(values)-1) {
+			kept = append(kept, i)
+		}
+	}
+
+	return kept
+}
+
+// pickIndices returns the elements at the given indices
+func pickIndices[T any](values []T, indices []int) []T {
+	picked := make([]T, len(indices))
+	for i, index := range indices {
+		picked[i] = values[index]
+	}
+	return picked
+}
+
+// dedupeStrings keeps only the samples that differ exactly from the previous one, with keepLast as above
+func dedupeStrings(times []time.Time, values []string, keepLast bool) ([]time.Time, []string) {
+	if len(values) == 0 {
+		return times, values
+	}
+
+	dtimes := []time.Time{times[0]}
+	dvalues := []string{values[0]}
+
+	for i := 1; i < len(values); i++ {
+		if values[i] != dvalues[len(dvalues)-1] || (keepLast && i == len(values)-1) {
+			dtimes = append(dtimes, times[i])
+			dvalues = append(dvalues, values[i])
+		}
+	}
+
+	return dtimes, dvalues
+}
@@ -0,0 +1,50 @@
+package plugin
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDedupeFloats(t *testing.T) {
+	now := time.Now()
+	times := make([]time.Time, 7)
+	for i := range times {
+		times[i] = now.Add(time.Duration(i) * time.Second)
+	}
+	values := []float64{1, 1, 1.05, 2, math.NaN(), math.NaN(), 2}
+
+	dtimes, dvalues := dedupeFloats(times, values, 0.1, false)
+	if len(dvalues) != 4 || dvalues[1] != 2 || !math.IsNaN(dvalues[2]) || dvalues[3] != 2 {
+		t.Fatalf("unexpected values %v", dvalues)
+	}
+	if !dtimes[1].Equal(times[3]) {
+		t.Errorf("times not aligned with values")
+	}
+
+	// A slow drift is caught once it moves far enough from the last kept value
+	_, dvalues = dedupeFloats(times[:4], []float64{1, 1.06, 1.12, 1.18}, 0.1, false)
+	if len(dvalues) != 2 || dvalues[1] != 1.12 {
+		t.Errorf("unexpected drift values %v", dvalues)
+	}
+
+	dtimes, _ = dedupeFloats(times[:3], []float64{5, 5, 5}, 0, true)
+	if len(dtimes) != 2 || !dtimes[1].Equal(times[2]) {
+		t.Errorf("expected the final sample to be kept")
+	}
+}
+
+func TestDedupeStrings(t *testing.T) {
+	now := time.Now()
+	times := []time.Time{now, now.Add(time.Second), now.Add(2 * time.Second), now.Add(3 * time.Second)}
+
+	_, dvalues := dedupeStrings(times, []string{"Open", "Open", "Closed", "Closed"}, false)
+	if len(dvalues) != 2 || dvalues[1] != "Closed" {
+		t.Errorf("unexpected values %v", dvalues)
+	}
+
+	dtimes, _ := dedupeStrings(times, []string{"Open", "Open", "Closed", "Closed"}, true)
+	if len(dtimes) != 3 || !dtimes[2].Equal(times[3]) {
+		t.Errorf("expected the final sample to be kept")
+	}
+}
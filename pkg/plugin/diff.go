@@ -0,0 +1,173 @@
+package plugin
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// The most services a pattern may match in one diff, each one costs two snapshot statements
+const DIFF_MAX_SERVICES = 50
+
+// isServicePattern reports whether a service name is a glob pattern such as "ao*" rather than a single service
+func isServicePattern(service string) bool {
+	return strings.ContainsAny(service, "*?")
+}
+
+// globToLike converts a glob pattern to a SQL LIKE pattern, escaping anything LIKE would otherwise interpret
+func globToLike(glob string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`, "*", "%", "?", "_")
+	return replacer.Replace(glob)
+}
+
+// matchServices lists the services in the meta table matching a glob pattern
+func matchServices(db *sql.DB, config *DatasourceSettings, pattern string) ([]string, error) {
+	sql_services := fmt.Sprintf("select distinct service from %s where service like $1 order by service asc;", config.metaTable())
+	rows, err := db.Query(sql_services, globToLike(pattern))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	services := []string{}
+	var service string
+	for rows.Next() {
+		err = rows.Scan(&service)
+		if err != nil {
+			return nil, err
+		}
+		services = append(services, service)
+	}
+
+	return services, rows.Err()
+}
+
+// snapshotDiff is one keyword whose value differs between two snapshots
+type snapshotDiff struct {
+	service string
+	a       snapshotRow
+	b       snapshotRow
+}
+
+// diffSnapshots compares two snapshots of the same service keyword by keyword, returning only the keywords whose
+// value differs, including those sampled at one instant but not yet at the other
+func diffSnapshots(service string, a []snapshotRow, b []snapshotRow) []snapshotDiff {
+	before := map[string]snapshotRow{}
+	for _, row := range a {
+		before[row.keyword] = row
+	}
+
+	diffs := []snapshotDiff{}
+	for _, row := range b {
+		prior := before[row.keyword]
+		if prior.found == row.found && prior.raw == row.raw {
+			continue
+		}
+		diffs = append(diffs, snapshotDiff{service: service, a: prior, b: row})
+	}
+
+	return diffs
+}
+
+// queryDiff compares the state of a service, or every service matching a pattern, at two instants: the query's
+// at and compare instants, which default to the start and end of the range
+func queryDiff(db *sql.DB, config *DatasourceSettings, query backend.DataQuery, qm queryModel, service string) backend.DataResponse {
+	response := backend.DataResponse{}
+
+	at_a, err := parseInstant(qm.At, query.TimeRange.From)
+	if err != nil {
+		response.Error = err
+		return response
+	}
+	at_b, err := parseInstant(qm.Compare, query.TimeRange.To)
+	if err != nil {
+		response.Error = err
+		return response
+	}
+
+	services := []string{service}
+	if isServicePattern(service) {
+		services, err = matchServices(db, config, service)
+		if err != nil {
+			log.DefaultLogger.Error(fl() + "service pattern error: " + err.Error())
+			response.Error = err
+			return response
+		}
+		if len(services) > DIFF_MAX_SERVICES {
+			response.Error = fmt.Errorf("%s matches %d services, more than %d", service, len(services), DIFF_MAX_SERVICES)
+			return response
+		}
+	}
+
+	diffs := []snapshotDiff{}
+	for _, s := range services {
+		a, err := loadSnapshot(db, config, s, at_a)
+		if err != nil {
+			log.DefaultLogger.Error(fl() + "snapshot retrieval error: " + err.Error())
+			response.Error = err
+			return response
+		}
+		b, err := loadSnapshot(db, config, s, at_b)
+		if err != nil {
+			log.DefaultLogger.Error(fl() + "snapshot retrieval error: " + err.Error())
+			response.Error = err
+			return response
+		}
+		diffs = append(diffs, diffSnapshots(s, a, b)...)
+	}
+
+	response.Frames = append(response.Frames, diffFrame(diffs))
+	response.Frames[0].RefID = qm.RefId
+	return response
+}
+
+// diffFrame builds the table of differing keywords with both values, both sample times and the numeric delta
+// (second minus first) where both values are numbers
+func diffFrame(diffs []snapshotDiff) *data.Frame {
+	services := make([]string, len(diffs))
+	keywords := make([]string, len(diffs))
+	values_a := make([]*string, len(diffs))
+	values_b := make([]*string, len(diffs))
+	times_a := make([]*time.Time, len(diffs))
+	times_b := make([]*time.Time, len(diffs))
+	deltas := make([]*float64, len(diffs))
+
+	for i, diff := range diffs {
+		services[i] = diff.service
+		keywords[i] = diff.b.keyword
+
+		if diff.a.found {
+			value, sample_time := rawValue(diff.a.raw), diff.a.time
+			values_a[i], times_a[i] = &value, &sample_time
+		}
+		if diff.b.found {
+			value, sample_time := rawValue(diff.b.raw), diff.b.time
+			values_b[i], times_b[i] = &value, &sample_time
+		}
+
+		// The second row always has the type, the first is empty if the keyword is new to the meta table
+		diff.a.keyword_type = diff.b.keyword_type
+		if a, b := diff.a.numericValue(), diff.b.numericValue(); a != nil && b != nil {
+			delta := *b - *a
+			deltas[i] = &delta
+		}
+	}
+
+	frame := data.NewFrame("diff",
+		data.NewField("service", nil, services),
+		data.NewField("keyword", nil, keywords),
+		data.NewField("value A", nil, values_a),
+		data.NewField("value B", nil, values_b),
+		data.NewField("time A", nil, times_a),
+		data.NewField("time B", nil, times_b),
+		data.NewField("delta", nil, deltas),
+	)
+	setFrameType(frame, data.FrameTypeTable)
+
+	return frame
+}
@@ -0,0 +1,72 @@
+package plugin
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestGlobToLike(t *testing.T) {
+	cases := map[string]string{
+		"ao*":     "ao%",
+		"dcs?":    "dcs_",
+		"my_serv": `my\_serv`,
+		"100%*":   `100\%%`,
+	}
+
+	for glob, expected := range cases {
+		if like := globToLike(glob); like != expected {
+			t.Errorf("%q: expected %q, got %q", glob, expected, like)
+		}
+	}
+
+	if isServicePattern("dcs") || !isServicePattern("dcs*") {
+		t.Error("unexpected service pattern detection")
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	t0 := time.Unix(1700000000, 0).UTC()
+	t1 := t0.Add(time.Hour)
+	value := func(s string) sql.NullString { return sql.NullString{String: s, Valid: true} }
+
+	a := []snapshotRow{
+		{keyword: "SAME", keyword_type: "KTL_DOUBLE", found: true, time: t0, raw: value("1")},
+		{keyword: "MOVED", keyword_type: "KTL_DOUBLE", found: true, time: t0, raw: value("1.5")},
+		{keyword: "NAME", keyword_type: "KTL_STRING", found: true, time: t0, raw: value("old")},
+		{keyword: "NEW", keyword_type: "KTL_DOUBLE", found: false},
+	}
+	b := []snapshotRow{
+		{keyword: "SAME", keyword_type: "KTL_DOUBLE", found: true, time: t0, raw: value("1")},
+		{keyword: "MOVED", keyword_type: "KTL_DOUBLE", found: true, time: t1, raw: value("4")},
+		{keyword: "NAME", keyword_type: "KTL_STRING", found: true, time: t1, raw: value("new")},
+		{keyword: "NEW", keyword_type: "KTL_DOUBLE", found: true, time: t1, raw: value("2")},
+	}
+
+	diffs := diffSnapshots("dcs", a, b)
+	if len(diffs) != 3 {
+		t.Fatalf("expected 3 differences, got %d", len(diffs))
+	}
+
+	frame := diffFrame(diffs)
+	if frame.Rows() != 3 {
+		t.Fatalf("expected 3 rows, got %d", frame.Rows())
+	}
+
+	keywords := []string{"MOVED", "NAME", "NEW"}
+	deltas := []*float64{ptr(2.5), nil, nil}
+	for i, keyword := range keywords {
+		if frame.Fields[0].At(i).(string) != "dcs" || frame.Fields[1].At(i).(string) != keyword {
+			t.Errorf("row %d: unexpected service or keyword", i)
+		}
+		delta := frame.Fields[6].At(i).(*float64)
+		if (delta == nil) != (deltas[i] == nil) || (delta != nil && *delta != *deltas[i]) {
+			t.Errorf("row %d: unexpected delta %v", i, delta)
+		}
+	}
+
+	// A keyword with no sample at the first instant has no first value or time
+	if frame.Fields[2].At(2).(*string) != nil || frame.Fields[4].At(2).(*time.Time) != nil {
+		t.Error("expected no first value for a newly sampled keyword")
+	}
+}
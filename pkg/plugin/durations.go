@@ -0,0 +1,89 @@
+package plugin
+
+import (
+	"sort"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// stateDuration is the time a keyword spent at one value
+type stateDuration struct {
+	value    string
+	duration time.Duration
+	entries  int
+}
+
+// stateDurations totals the time spent at each value with sample-and-hold semantics, each sample holding until the
+// next change and the last until the end of the range, all clipped to the range.  Entries counts the runs of each
+// value.  The result is sorted longest first.
+func stateDurations(times []time.Time, texts []string, from time.Time, to time.Time) []stateDuration {
+	totals := map[string]*stateDuration{}
+	order := []string{}
+
+	for i := range texts {
+		start := times[i]
+		end := to
+		if i+1 < len(times) {
+			end = times[i+1]
+		}
+
+		// Clip to the range
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+
+		total, ok := totals[texts[i]]
+		if !ok {
+			total = &stateDuration{value: texts[i]}
+			totals[texts[i]] = total
+			order = append(order, texts[i])
+		}
+
+		if i == 0 || texts[i] != texts[i-1] {
+			total.entries++
+		}
+		if end.After(start) {
+			total.duration += end.Sub(start)
+		}
+	}
+
+	result := make([]stateDuration, len(order))
+	for i, value := range order {
+		result[i] = *totals[value]
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].duration > result[j].duration })
+
+	return result
+}
+
+// durationsFrame builds the table of values with their total duration in seconds, fraction of the range and
+// number of entries
+func durationsFrame(durations []stateDuration, span time.Duration) *data.Frame {
+	values := make([]string, len(durations))
+	seconds := make([]float64, len(durations))
+	fractions := make([]float64, len(durations))
+	entries := make([]int64, len(durations))
+
+	for i, d := range durations {
+		values[i] = d.value
+		seconds[i] = d.duration.Seconds()
+		if span > 0 {
+			fractions[i] = d.duration.Seconds() / span.Seconds()
+		}
+		entries[i] = int64(d.entries)
+	}
+
+	frame := data.NewFrame("durations",
+		data.NewField("value", nil, values),
+		data.NewField("duration", nil, seconds).SetConfig(&data.FieldConfig{Unit: "s"}),
+		data.NewField("fraction", nil, fractions).SetConfig(&data.FieldConfig{Unit: "percentunit"}),
+		data.NewField("entries", nil, entries),
+	)
+	setFrameType(frame, data.FrameTypeTable)
+
+	return frame
+}
@@ -0,0 +1,37 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStateDurations(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+
+	// The first sample is the value carried in from before the range
+	times := []time.Time{from.Add(-time.Hour), from.Add(10 * time.Minute), from.Add(20 * time.Minute), from.Add(40 * time.Minute)}
+	texts := []string{"Closed", "Open", "Open", "Closed"}
+
+	durations := stateDurations(times, texts, from, to)
+	if len(durations) != 2 {
+		t.Fatalf("expected 2 states, got %d", len(durations))
+	}
+	if durations[0].value != "Closed" || durations[0].duration != 30*time.Minute || durations[0].entries != 2 {
+		t.Errorf("unexpected Closed %+v", durations[0])
+	}
+	if durations[1].value != "Open" || durations[1].duration != 30*time.Minute || durations[1].entries != 1 {
+		t.Errorf("unexpected Open %+v", durations[1])
+	}
+
+	frame := durationsFrame(durations, to.Sub(from))
+	if frame.Fields[2].At(0).(float64) != 0.5 || frame.Fields[3].At(0).(int64) != 2 {
+		t.Errorf("unexpected durations frame")
+	}
+}
+
+func TestUnixToTime(t *testing.T) {
+	if ts := unixToTime(1700000000.25); ts.Unix() != 1700000000 || ts.Nanosecond() != 250000000 {
+		t.Errorf("unexpected time %s", ts)
+	}
+}
@@ -0,0 +1,136 @@
+package plugin
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/lib/pq"
+)
+
+// isEnumType reports whether a KTL type is archived as the integer index of an enumerator
+func isEnumType(keyword_type string) bool {
+	return keyword_type == "KTL_ENUM" || keyword_type == "KTL_ENUMM"
+}
+
+// loadEnumerators returns the value to label mapping for a keyword.  The configured enum table is used when there
+// is one, with a row per (service, keyword, value, label), otherwise the enumerators column of the meta table is
+// parsed.  A keyword without enumerators, or a meta table without that column, gives an empty mapping rather than
+// an error.
+func loadEnumerators(db *sql.DB, config *DatasourceSettings, service string, keyword string) (map[int64]string, error) {
+	enumerators := map[int64]string{}
+
+	if config.EnumTable != "" {
+		sql_enum := fmt.Sprintf("select value, label from %s where service = $1 and keyword = $2 order by value asc;", pq.QuoteIdentifier(config.EnumTable))
+		rows, err := db.Query(sql_enum, service, keyword)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		var value int64
+		var label string
+		for rows.Next() {
+			err = rows.Scan(&value, &label)
+			if err != nil {
+				return nil, err
+			}
+			enumerators[value] = label
+		}
+
+		return enumerators, rows.Err()
+	}
+
+	sql_enum := fmt.Sprintf("select enumerators from %s where service = $1 and keyword = $2 limit 1;", config.metaTable())
+	row := db.QueryRow(sql_enum, service, keyword)
+
+	var list sql.NullString
+	switch err := row.Scan(&list); err {
+	case sql.ErrNoRows:
+		return enumerators, nil
+	case nil:
+		return parseEnumerators(list.String)
+	default:
+		if isUndefinedColumn(err) {
+			return enumerators, nil
+		}
+		return nil, err
+	}
+}
+
+// metaEnumerators parses the enumerators column of a meta table row read as JSON, a row without the column has none
+func metaEnumerators(row map[string]interface{}) (map[int64]string, error) {
+	list, _ := row["enumerators"].(string)
+	return parseEnumerators(list)
+}
+
+// parseEnumerators parses a comma separated enumerator list from the meta table.  Entries are either bare labels,
+// numbered from zero in order, or explicit "value=label" pairs; the two styles may not be mixed.
+func parseEnumerators(list string) (map[int64]string, error) {
+	enumerators := map[int64]string{}
+	if strings.TrimSpace(list) == "" {
+		return enumerators, nil
+	}
+
+	entries := strings.Split(list, ",")
+	explicit := strings.Contains(entries[0], "=")
+
+	for i, entry := range entries {
+		if !explicit {
+			if strings.Contains(entry, "=") {
+				return nil, fmt.Errorf("mixed enumerator styles: %q", list)
+			}
+			enumerators[int64(i)] = strings.TrimSpace(entry)
+			continue
+		}
+
+		value, label, found := strings.Cut(entry, "=")
+		if !found {
+			return nil, fmt.Errorf("mixed enumerator styles: %q", list)
+		}
+		index, err := strconv.ParseInt(strings.TrimSpace(value), 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid enumerator value: %q", entry)
+		}
+		enumerators[index] = strings.TrimSpace(label)
+	}
+
+	return enumerators, nil
+}
+
+// enumMappings turns enumerators into value mappings so panels show the labels in place of the numbers
+func enumMappings(enumerators map[int64]string) data.ValueMappings {
+	values := make([]int64, 0, len(enumerators))
+	for value := range enumerators {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	mapper := data.ValueMapper{}
+	for i, value := range values {
+		mapper[strconv.FormatInt(value, 10)] = data.ValueMappingResult{Text: enumerators[value], Index: i}
+	}
+
+	return data.ValueMappings{mapper}
+}
+
+// enumLabels converts enumerated values to their labels, values without an enumerator keep their number
+// and NaN (an unreadable row) becomes null
+func enumLabels(values []float64, enumerators map[int64]string) []*string {
+	labels := make([]*string, len(values))
+	for i, value := range values {
+		if math.IsNaN(value) {
+			continue
+		}
+		label, ok := enumerators[int64(value)]
+		if !ok || float64(int64(value)) != value {
+			label = strconv.FormatFloat(value, 'f', -1, 64)
+		}
+		labels[i] = &label
+	}
+	return labels
+}
@@ -0,0 +1,55 @@
+package plugin
+
+import (
+	"math"
+	"testing"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestParseEnumerators(t *testing.T) {
+	enumerators, err := parseEnumerators("Closed, Open ,Moving")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(enumerators) != 3 || enumerators[0] != "Closed" || enumerators[1] != "Open" || enumerators[2] != "Moving" {
+		t.Errorf("unexpected enumerators %v", enumerators)
+	}
+
+	enumerators, err = parseEnumerators("-1=Fault,2=Idle,0x10=Busy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enumerators[-1] != "Fault" || enumerators[2] != "Idle" || enumerators[16] != "Busy" {
+		t.Errorf("unexpected enumerators %v", enumerators)
+	}
+
+	if enumerators, err = parseEnumerators(""); err != nil || len(enumerators) != 0 {
+		t.Errorf("expected no enumerators from an empty list")
+	}
+
+	if _, err = parseEnumerators("Closed,1=Open"); err == nil {
+		t.Error("expected an error for mixed styles")
+	}
+}
+
+func TestEnumLabelsAndMappings(t *testing.T) {
+	enumerators := map[int64]string{0: "Closed", 1: "Open"}
+
+	labels := enumLabels([]float64{0, 1, 2, 0.5, math.NaN()}, enumerators)
+	expected := []string{"Closed", "Open", "2", "0.5"}
+	for i := range expected {
+		if *labels[i] != expected[i] {
+			t.Fatalf("expected %s, got %s", expected[i], *labels[i])
+		}
+	}
+	if labels[4] != nil {
+		t.Errorf("expected a null label for NaN")
+	}
+
+	mappings := enumMappings(enumerators)
+	mapper := mappings[0].(data.ValueMapper)
+	if mapper["1"].Text != "Open" || mapper["1"].Index != 1 {
+		t.Errorf("unexpected mappings %v", mapper)
+	}
+}
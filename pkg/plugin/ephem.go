@@ -0,0 +1,259 @@
+package plugin
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// The ephem service is not in the archive, its keywords are computed for the query range at the configured site
+const EPHEM_SERVICE = "ephem"
+
+// Default site is the Keck telescopes on Maunakea
+const (
+	EPHEM_DEFAULT_LATITUDE  = 19.8260
+	EPHEM_DEFAULT_LONGITUDE = -155.4747
+)
+
+// The computed keywords and their descriptions.  Altitudes are in degrees, LST is in hours.
+var ephemKeywords = map[string]string{
+	"SUNALT":    "sun altitude (deg)",
+	"MOONALT":   "moon altitude (deg)",
+	"MOONILLUM": "moon illuminated fraction (0-1)",
+	"LST":       "local sidereal time (h)",
+	"JD":        "Julian Date",
+}
+
+// ephemKeywordOptions returns the ephem keywords in name order, in the same shape as the /keywords resource
+func ephemKeywordOptions() []resourceOption {
+	names := make([]string, 0, len(ephemKeywords))
+	for keyword := range ephemKeywords {
+		names = append(names, keyword)
+	}
+	sort.Strings(names)
+
+	keywords := make([]resourceOption, len(names))
+	for i, keyword := range names {
+		keywords[i] = resourceOption{Value: keyword, Label: EPHEM_SERVICE + "." + keyword}
+	}
+	return keywords
+}
+
+// siteLocation returns the configured latitude and longitude in degrees, falling back to Maunakea
+func (config *DatasourceSettings) siteLocation() (float64, float64, error) {
+	lat, lon := EPHEM_DEFAULT_LATITUDE, EPHEM_DEFAULT_LONGITUDE
+
+	var err error
+	if config.Latitude != "" {
+		lat, err = strconv.ParseFloat(config.Latitude, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid site latitude: %s", config.Latitude)
+		}
+	}
+	if config.Longitude != "" {
+		lon, err = strconv.ParseFloat(config.Longitude, 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid site longitude: %s", config.Longitude)
+		}
+	}
+
+	return lat, lon, nil
+}
+
+// queryEphem computes one ephem keyword across the query time range
+func queryEphem(query backend.DataQuery, qm queryModel, keyword string, config *DatasourceSettings) backend.DataResponse {
+	response := backend.DataResponse{}
+
+	if _, ok := ephemKeywords[keyword]; !ok {
+		response.Error = fmt.Errorf("unknown %s keyword: %s", EPHEM_SERVICE, keyword)
+		return response
+	}
+
+	// Computed values change continuously and have no samples of their own, so there are no transitions, states or
+	// latest sample to report
+	switch qm.Mode {
+	case QUERY_MODE_ANNOTATIONS, QUERY_MODE_DURATIONS, QUERY_MODE_INSTANT:
+		response.Error = fmt.Errorf("%s is computed, this query mode is not supported for %s keywords", qm.QueryText, EPHEM_SERVICE)
+		return response
+	}
+
+	lat, lon, err := config.siteLocation()
+	if err != nil {
+		response.Error = err
+		return response
+	}
+
+	// Step at the panel interval, but never produce more points than the panel (or we) can use
+	step := queryStep(query, QUERY_MAX_POINTS)
+
+	times := []time.Time{}
+	values := []float64{}
+
+	for t := query.TimeRange.From; !t.After(query.TimeRange.To); t = t.Add(step) {
+		jd := julianDate(t)
+
+		var value float64
+		switch keyword {
+		case "SUNALT":
+			ra, dec := sunPosition(jd)
+			value = altitude(ra, dec, jd, lat, lon)
+
+		case "MOONALT":
+			ra, dec, parallax := moonPosition(jd)
+			// Correct the geocentric altitude for the moon's horizontal parallax
+			alt := altitude(ra, dec, jd, lat, lon)
+			value = alt - parallax*math.Cos(alt*math.Pi/180)
+
+		case "MOONILLUM":
+			value = moonIllumination(jd)
+
+		case "LST":
+			value = localSiderealTime(jd, lon) / 15
+
+		case "JD":
+			value = jd
+		}
+
+		// Unit conversions apply to the computed values just like archived ones
+		value, err = convertUnits(value, qm.UnitConversion)
+		if err != nil {
+			response.Error = err
+			return response
+		}
+
+		times = append(times, t)
+		values = append(values, value)
+	}
+
+	times, values, err = transformValues(times, values, qm)
+	if err != nil {
+		response.Error = err
+		return response
+	}
+
+	// Threshold events work on the computed series the same as on an archived one, the sun below a twilight
+	// altitude for example
+	if qm.Mode == QUERY_MODE_EVENTS {
+		condition, err := newEventCondition(qm)
+		if err != nil {
+			response.Error = err
+			return response
+		}
+
+		min_duration := time.Duration(qm.MinDuration * float64(time.Second))
+		frame := eventsFrame(findEvents(times, values, condition, query.TimeRange.To, min_duration), EPHEM_SERVICE, keyword)
+		frame.RefID = qm.RefId
+		response.Frames = append(response.Frames, frame)
+		return response
+	}
+
+	frame := data.NewFrame("response")
+	frame.RefID = qm.RefId
+	frame.Name = qm.QueryText
+	frame.Fields = append(frame.Fields, data.NewField("", nil, values))
+	frame.Fields = append(frame.Fields, data.NewField("time", nil, times))
+
+	return formattedResponse(response, frame, query, qm, EPHEM_SERVICE, keyword, nil)
+}
+
+// The positional astronomy below uses the low precision formulae of the Astronomical Almanac (section C for the
+// sun, section D for the moon), good to about 0.01° for the sun and 0.3° for the moon, which is plenty for overlays.
+
+// julianDate converts a time to a Julian Date
+func julianDate(t time.Time) float64 {
+	return float64(t.UnixNano())/86400e9 + 2440587.5
+}
+
+// localSiderealTime returns the local mean sidereal time in degrees for an east-positive longitude
+func localSiderealTime(jd float64, lon float64) float64 {
+	d := jd - 2451545.0
+	T := d / 36525
+	gmst := 280.46061837 + 360.98564736629*d + 0.000387933*T*T - T*T*T/38710000
+	return normalizeDegrees(gmst + lon)
+}
+
+// sunLongitude returns the apparent ecliptic longitude of the sun in degrees
+func sunLongitude(jd float64) float64 {
+	n := jd - 2451545.0
+	L := 280.460 + 0.9856474*n
+	g := (357.528 + 0.9856003*n) * math.Pi / 180
+	return normalizeDegrees(L + 1.915*math.Sin(g) + 0.020*math.Sin(2*g))
+}
+
+// sunPosition returns the right ascension and declination of the sun in degrees
+func sunPosition(jd float64) (float64, float64) {
+	return eclipticToEquatorial(sunLongitude(jd), 0, jd)
+}
+
+// moonEcliptic returns the geocentric ecliptic longitude, latitude and horizontal parallax of the moon in degrees
+func moonEcliptic(jd float64) (float64, float64, float64) {
+	T := (jd - 2451545.0) / 36525
+
+	sind := func(x float64) float64 { return math.Sin(x * math.Pi / 180) }
+	cosd := func(x float64) float64 { return math.Cos(x * math.Pi / 180) }
+
+	lambda := 218.32 + 481267.881*T +
+		6.29*sind(135.0+477198.87*T) - 1.27*sind(259.3-413335.36*T) +
+		0.66*sind(235.7+890534.22*T) + 0.21*sind(269.9+954397.74*T) -
+		0.19*sind(357.5+35999.05*T) - 0.11*sind(186.5+966404.03*T)
+
+	beta := 5.13*sind(93.3+483202.02*T) + 0.28*sind(228.2+960400.89*T) -
+		0.28*sind(318.3+6003.15*T) - 0.17*sind(217.6-407332.21*T)
+
+	parallax := 0.9508 + 0.0518*cosd(135.0+477198.87*T) + 0.0095*cosd(259.3-413335.36*T) +
+		0.0078*cosd(235.7+890534.22*T) + 0.0028*cosd(269.9+954397.74*T)
+
+	return normalizeDegrees(lambda), beta, parallax
+}
+
+// moonPosition returns the geocentric right ascension, declination and horizontal parallax of the moon in degrees
+func moonPosition(jd float64) (float64, float64, float64) {
+	lambda, beta, parallax := moonEcliptic(jd)
+	ra, dec := eclipticToEquatorial(lambda, beta, jd)
+	return ra, dec, parallax
+}
+
+// moonIllumination returns the illuminated fraction of the moon's disk, 0 at new moon and 1 at full
+func moonIllumination(jd float64) float64 {
+	lambda, beta, _ := moonEcliptic(jd)
+
+	// Elongation of the moon from the sun, the phase angle is its supplement to a good approximation
+	cosElongation := math.Cos(beta*math.Pi/180) * math.Cos((lambda-sunLongitude(jd))*math.Pi/180)
+	return (1 - cosElongation) / 2
+}
+
+// eclipticToEquatorial converts ecliptic longitude and latitude to right ascension and declination, all degrees
+func eclipticToEquatorial(lambda float64, beta float64, jd float64) (float64, float64) {
+	eps := (23.439 - 0.0000004*(jd-2451545.0)) * math.Pi / 180
+	l := lambda * math.Pi / 180
+	b := beta * math.Pi / 180
+
+	ra := math.Atan2(math.Sin(l)*math.Cos(eps)-math.Tan(b)*math.Sin(eps), math.Cos(l))
+	dec := math.Asin(math.Sin(b)*math.Cos(eps) + math.Cos(b)*math.Sin(eps)*math.Sin(l))
+
+	return normalizeDegrees(ra * 180 / math.Pi), dec * 180 / math.Pi
+}
+
+// altitude returns the altitude in degrees of an object at the given site and time, ignoring refraction
+func altitude(ra float64, dec float64, jd float64, lat float64, lon float64) float64 {
+	ha := (localSiderealTime(jd, lon) - ra) * math.Pi / 180
+	phi := lat * math.Pi / 180
+	delta := dec * math.Pi / 180
+
+	sinAlt := math.Sin(phi)*math.Sin(delta) + math.Cos(phi)*math.Cos(delta)*math.Cos(ha)
+	return math.Asin(sinAlt) * 180 / math.Pi
+}
+
+// normalizeDegrees maps an angle into [0, 360)
+func normalizeDegrees(deg float64) float64 {
+	deg = math.Mod(deg, 360)
+	if deg < 0 {
+		deg += 360
+	}
+	return deg
+}
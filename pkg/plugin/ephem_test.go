@@ -0,0 +1,92 @@
+package plugin
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+)
+
+func TestJulianDate(t *testing.T) {
+	j2000 := time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)
+	if jd := julianDate(j2000); math.Abs(jd-2451545.0) > 1e-9 {
+		t.Errorf("J2000 julian date = %f", jd)
+	}
+
+	// Sidereal time at Greenwich at the epoch is the constant term of the GMST expression
+	if lst := localSiderealTime(2451545.0, 0); math.Abs(lst-280.46061837) > 1e-6 {
+		t.Errorf("J2000 GMST = %f", lst)
+	}
+}
+
+func TestSunAltitude(t *testing.T) {
+	// Local midnight and local noon at Maunakea on the June solstice
+	midnight := julianDate(time.Date(2024, 6, 21, 10, 0, 0, 0, time.UTC))
+	noon := julianDate(time.Date(2024, 6, 21, 22, 30, 0, 0, time.UTC))
+
+	ra, dec := sunPosition(midnight)
+	if alt := altitude(ra, dec, midnight, EPHEM_DEFAULT_LATITUDE, EPHEM_DEFAULT_LONGITUDE); alt > -40 {
+		t.Errorf("sun altitude at midnight = %f", alt)
+	}
+
+	ra, dec = sunPosition(noon)
+	if alt := altitude(ra, dec, noon, EPHEM_DEFAULT_LATITUDE, EPHEM_DEFAULT_LONGITUDE); alt < 80 {
+		t.Errorf("sun altitude at noon = %f", alt)
+	}
+}
+
+func TestMoonIllumination(t *testing.T) {
+	full := julianDate(time.Date(2024, 1, 25, 17, 54, 0, 0, time.UTC))
+	if k := moonIllumination(full); k < 0.99 {
+		t.Errorf("full moon illumination = %f", k)
+	}
+
+	new := julianDate(time.Date(2024, 1, 11, 11, 57, 0, 0, time.UTC))
+	if k := moonIllumination(new); k > 0.01 {
+		t.Errorf("new moon illumination = %f", k)
+	}
+}
+
+func TestQueryEphem(t *testing.T) {
+	from := time.Date(2024, 6, 21, 0, 0, 0, 0, time.UTC)
+	query := backend.DataQuery{
+		TimeRange:     backend.TimeRange{From: from, To: from.Add(time.Hour)},
+		Interval:      time.Minute,
+		MaxDataPoints: 1000,
+	}
+	qm := queryModel{QueryText: "ephem.JD"}
+	query.JSON, _ = json.Marshal(qm)
+
+	response := queryEphem(query, qm, "JD", &DatasourceSettings{})
+	if response.Error != nil {
+		t.Fatal(response.Error)
+	}
+	if n := response.Frames[0].Rows(); n != 61 {
+		t.Errorf("expected 61 rows, got %d", n)
+	}
+
+	response = queryEphem(query, qm, "BOGUS", &DatasourceSettings{})
+	if response.Error == nil {
+		t.Error("expected an error for an unknown keyword")
+	}
+
+	// The Julian date passes the threshold half way through the hour, one event from there to the end
+	jd := julianDate(from.Add(30 * time.Minute))
+	events := queryModel{QueryText: "ephem.JD", Mode: QUERY_MODE_EVENTS, Condition: CONDITION_ABOVE, Threshold: jd}
+	response = queryEphem(query, events, "JD", &DatasourceSettings{})
+	if response.Error != nil {
+		t.Fatal(response.Error)
+	}
+	if n := response.Frames[0].Rows(); n != 1 {
+		t.Errorf("expected 1 event, got %d", n)
+	}
+
+	for _, mode := range []int{QUERY_MODE_ANNOTATIONS, QUERY_MODE_DURATIONS, QUERY_MODE_INSTANT} {
+		unsupported := queryModel{QueryText: "ephem.JD", Mode: mode}
+		if response = queryEphem(query, unsupported, "JD", &DatasourceSettings{}); response.Error == nil {
+			t.Errorf("mode %d: expected an error for a computed keyword", mode)
+		}
+	}
+}
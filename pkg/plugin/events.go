@@ -0,0 +1,168 @@
+package plugin
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Define the event conditions, this maps onto the conditionOptions list in QueryEditor.tsx
+const (
+	CONDITION_ABOVE   = iota // value > threshold
+	CONDITION_BELOW   = iota // value < threshold
+	CONDITION_INSIDE  = iota // threshold <= value <= thresholdHigh
+	CONDITION_OUTSIDE = iota // value < threshold or value > thresholdHigh
+)
+
+// eventCondition decides when an event starts and ends.  The hysteresis widens the condition once an event has
+// started, so a value hovering around the threshold doesn't start and end an event on every sample.
+type eventCondition struct {
+	kind       int
+	low        float64
+	high       float64
+	hysteresis float64
+}
+
+// newEventCondition checks the query's condition settings
+func newEventCondition(qm queryModel) (eventCondition, error) {
+	c := eventCondition{kind: qm.Condition, low: qm.Threshold, high: qm.ThresholdHigh, hysteresis: math.Abs(qm.Hysteresis)}
+
+	switch c.kind {
+	case CONDITION_ABOVE, CONDITION_BELOW:
+	case CONDITION_INSIDE, CONDITION_OUTSIDE:
+		if c.high < c.low {
+			return c, fmt.Errorf("threshold range is empty: %g to %g", c.low, c.high)
+		}
+	default:
+		return c, fmt.Errorf("Unknown condition: %d", c.kind)
+	}
+
+	return c, nil
+}
+
+// starts reports whether a value starts an event
+func (c eventCondition) starts(v float64) bool {
+	switch c.kind {
+	case CONDITION_ABOVE:
+		return v > c.low
+	case CONDITION_BELOW:
+		return v < c.low
+	case CONDITION_INSIDE:
+		return v >= c.low && v <= c.high
+	default:
+		return v < c.low || v > c.high
+	}
+}
+
+// continues reports whether a value keeps an event going, this is where the hysteresis comes in
+func (c eventCondition) continues(v float64) bool {
+	switch c.kind {
+	case CONDITION_ABOVE:
+		return v >= c.low-c.hysteresis
+	case CONDITION_BELOW:
+		return v <= c.low+c.hysteresis
+	case CONDITION_INSIDE:
+		return v >= c.low-c.hysteresis && v <= c.high+c.hysteresis
+	default:
+		return v < c.low+c.hysteresis || v > c.high-c.hysteresis
+	}
+}
+
+// excursion measures how far into the condition a value is, the peak of an event is its largest excursion
+func (c eventCondition) excursion(v float64) float64 {
+	switch c.kind {
+	case CONDITION_ABOVE:
+		return v
+	case CONDITION_BELOW:
+		return -v
+	case CONDITION_INSIDE:
+		return v
+	default:
+		return math.Max(c.low-v, v-c.high)
+	}
+}
+
+// keywordEvent is one interval during which a keyword satisfied the condition
+type keywordEvent struct {
+	start time.Time
+	end   time.Time
+	peak  float64
+}
+
+// findEvents returns the intervals over which the condition held, with sample-and-hold semantics: an event runs
+// from the sample that starts it to the first sample that ends it, or to the end of the range.  Events shorter
+// than minDuration are dropped.  Unreadable rows (NaN) neither start nor end an event.
+func findEvents(times []time.Time, values []float64, c eventCondition, to time.Time, minDuration time.Duration) []keywordEvent {
+	events := []keywordEvent{}
+
+	var current *keywordEvent
+	for i, v := range values {
+		if math.IsNaN(v) {
+			continue
+		}
+
+		if current == nil {
+			if c.starts(v) {
+				current = &keywordEvent{start: times[i], peak: v}
+			}
+			continue
+		}
+
+		if c.continues(v) {
+			if c.excursion(v) > c.excursion(current.peak) {
+				current.peak = v
+			}
+			continue
+		}
+
+		current.end = times[i]
+		if current.end.Sub(current.start) >= minDuration {
+			events = append(events, *current)
+		}
+		current = nil
+	}
+
+	// An event still going at the end of the data is clipped to the end of the range
+	if current != nil {
+		current.end = to
+		if current.end.Sub(current.start) >= minDuration {
+			events = append(events, *current)
+		}
+	}
+
+	return events
+}
+
+// eventsFrame builds one frame that serves both as a table of events and as annotations: time and timeEnd span
+// the event, with the duration in seconds and the peak value alongside the annotation text and tags
+func eventsFrame(events []keywordEvent, service string, keyword string) *data.Frame {
+	starts := make([]time.Time, len(events))
+	ends := make([]time.Time, len(events))
+	durations := make([]float64, len(events))
+	peaks := make([]float64, len(events))
+	texts := make([]string, len(events))
+	tags := make([]string, len(events))
+
+	for i, event := range events {
+		starts[i] = event.start
+		ends[i] = event.end
+		durations[i] = event.end.Sub(event.start).Seconds()
+		peaks[i] = event.peak
+		texts[i] = fmt.Sprintf("%s.%s peak %g for %s", service, keyword, event.peak, event.end.Sub(event.start).Round(time.Second))
+		tags[i] = service + "," + keyword
+	}
+
+	frame := data.NewFrame("events",
+		data.NewField("time", nil, starts),
+		data.NewField("timeEnd", nil, ends),
+		data.NewField("duration", nil, durations).SetConfig(&data.FieldConfig{Unit: "s"}),
+		data.NewField("peak", nil, peaks),
+		data.NewField("text", nil, texts),
+		data.NewField("tags", nil, tags),
+	)
+	setFrameType(frame, data.FrameTypeTable)
+
+	return frame
+}
@@ -0,0 +1,71 @@
+package plugin
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func eventTimes(n int) []time.Time {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	times := make([]time.Time, n)
+	for i := range times {
+		times[i] = from.Add(time.Duration(i) * time.Minute)
+	}
+	return times
+}
+
+func TestFindEventsAbove(t *testing.T) {
+	times := eventTimes(8)
+	values := []float64{10, 16, 18, 14.5, 16, 12, 17, math.NaN()}
+	to := times[7].Add(time.Minute)
+
+	// Without hysteresis the dip to 14.5 splits the event
+	c, _ := newEventCondition(queryModel{Condition: CONDITION_ABOVE, Threshold: 15})
+	events := findEvents(times, values, c, to, 0)
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+
+	// With it the dip is ridden through, and the last event runs to the end of the range
+	c, _ = newEventCondition(queryModel{Condition: CONDITION_ABOVE, Threshold: 15, Hysteresis: 1})
+	events = findEvents(times, values, c, to, 0)
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+	if !events[0].start.Equal(times[1]) || !events[0].end.Equal(times[5]) || events[0].peak != 18 {
+		t.Errorf("unexpected first event %+v", events[0])
+	}
+	if !events[1].end.Equal(to) {
+		t.Errorf("expected the last event clipped to the range end")
+	}
+
+	// A minimum duration drops the short one
+	events = findEvents(times, values, c, to, 3*time.Minute)
+	if len(events) != 1 {
+		t.Errorf("expected 1 event, got %d", len(events))
+	}
+}
+
+func TestFindEventsRange(t *testing.T) {
+	times := eventTimes(5)
+	values := []float64{0, 5, -3, 1, 0}
+
+	c, err := newEventCondition(queryModel{Condition: CONDITION_OUTSIDE, Threshold: -1, ThresholdHigh: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := findEvents(times, values, c, times[4], 0)
+	if len(events) != 1 || events[0].peak != 5 || !events[0].end.Equal(times[3]) {
+		t.Errorf("unexpected events %+v", events)
+	}
+
+	if _, err = newEventCondition(queryModel{Condition: CONDITION_INSIDE, Threshold: 2, ThresholdHigh: 1}); err == nil {
+		t.Error("expected an error for an empty range")
+	}
+
+	frame := eventsFrame(events, "met", "WINDSPD")
+	if frame.Rows() != 1 || frame.Fields[2].At(0).(float64) != 120 || frame.Fields[5].At(0) != "met,WINDSPD" {
+		t.Errorf("unexpected events frame")
+	}
+}
@@ -0,0 +1,499 @@
+package plugin
+
+import (
+	"compress/gzip"
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/lib/pq"
+)
+
+// Define the export file formats
+const (
+	EXPORT_FORMAT_CSV = "csv"
+	EXPORT_FORMAT_TSV = "tsv"
+)
+
+// Define how times are written in text exports
+const (
+	EXPORT_TIME_ISO  = "iso"
+	EXPORT_TIME_UNIX = "unix"
+)
+
+// Samples are read, transformed and written this many at a time, and the response is flushed after each chunk
+const EXPORT_CHUNK_ROWS = 10000
+
+// The most keywords one export may cover
+const EXPORT_MAX_KEYWORDS = 20
+
+// exportKeyword is one keyword to export along with its KTL type
+type exportKeyword struct {
+	service      string
+	keyword      string
+	keyword_type string
+}
+
+// numeric reports whether a keyword is exported as numbers, strings and arrays are exported as their text
+func (k exportKeyword) numeric() bool {
+	return k.keyword_type != "KTL_STRING" && !isArrayType(k.keyword_type)
+}
+
+// name is the keyword's full service.keyword name
+func (k exportKeyword) name() string {
+	return k.service + "." + k.keyword
+}
+
+// exportSample is one exported sample, numeric keywords have a value and the others have text.  Bad marks a value
+// that couldn't be read, NaN for a number or a null string.
+type exportSample struct {
+	time  time.Time
+	value float64
+	text  string
+	bad   bool
+}
+
+// exportRequest is an export's keywords, range and processing, the processing options are those of a query
+type exportRequest struct {
+	keywords []exportKeyword
+	from     time.Time
+	to       time.Time
+	qm       queryModel
+}
+
+// intParam reads an optional integer parameter, zero when it's absent
+func intParam(params url.Values, name string) (int, error) {
+	s := params.Get(name)
+	if s == "" {
+		return 0, nil
+	}
+	value, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %q", name, s)
+	}
+	return value, nil
+}
+
+// boolParam reads an optional boolean parameter, false when it's absent
+func boolParam(params url.Values, name string) (bool, error) {
+	s := params.Get(name)
+	if s == "" {
+		return false, nil
+	}
+	value, err := strconv.ParseBool(s)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %q", name, s)
+	}
+	return value, nil
+}
+
+// parseExportRequest reads the keywords (comma separated service.keyword names), range and processing options of
+// an export.  The range defaults to the last day; the processing options are named as in a query.
+func parseExportRequest(params url.Values) (exportRequest, error) {
+	request := exportRequest{}
+
+	for _, name := range strings.Split(params.Get("keywords"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		service, keyword, found := strings.Cut(name, ".")
+		if !found || service == "" || keyword == "" {
+			return request, fmt.Errorf("invalid keyword: %q, expected service.keyword", name)
+		}
+		request.keywords = append(request.keywords, exportKeyword{service: service, keyword: keyword})
+	}
+	if len(request.keywords) == 0 {
+		return request, fmt.Errorf("expected a keywords parameter")
+	}
+	if len(request.keywords) > EXPORT_MAX_KEYWORDS {
+		return request, fmt.Errorf("%d keywords is more than %d", len(request.keywords), EXPORT_MAX_KEYWORDS)
+	}
+
+	var err error
+	request.to, err = parseInstant(params.Get("to"), time.Now())
+	if err != nil {
+		return request, err
+	}
+	request.from, err = parseInstant(params.Get("from"), request.to.Add(-24*time.Hour))
+	if err != nil {
+		return request, err
+	}
+	if request.from.After(request.to) {
+		return request, fmt.Errorf("from is after to")
+	}
+
+	for name, target := range map[string]*int{
+		"unitConversion": &request.qm.UnitConversion,
+		"transform":      &request.qm.Transform,
+		"angleUnits":     &request.qm.AngleUnits,
+		"wrapInterval":   &request.qm.WrapInterval,
+	} {
+		if *target, err = intParam(params, name); err != nil {
+			return request, err
+		}
+	}
+	if request.qm.UnwrapFirst, err = boolParam(params, "unwrapFirst"); err != nil {
+		return request, err
+	}
+
+	// Check the options up front rather than failing part way through the stream
+	if _, err = convertUnits(0, request.qm.UnitConversion); err != nil {
+		return request, err
+	}
+	if _, _, err = transformValues(nil, nil, request.qm); err != nil {
+		return request, err
+	}
+
+	return request, nil
+}
+
+// loadExportTypes looks up the type of every keyword of an export, failing on the first one that doesn't exist
+func loadExportTypes(db *sql.DB, config *DatasourceSettings, keywords []exportKeyword) error {
+	sql_type := fmt.Sprintf("select type from %s where service = $1 and keyword = $2 limit 1;", config.metaTable())
+
+	for i, k := range keywords {
+		if k.service == EPHEM_SERVICE {
+			return badRequest(fmt.Errorf("%s keywords are computed, not archived", EPHEM_SERVICE))
+		}
+
+		switch err := db.QueryRow(sql_type, k.service, k.keyword).Scan(&keywords[i].keyword_type); err {
+		case sql.ErrNoRows:
+			return notFound(fmt.Errorf("unknown keyword: %s", k.name()))
+		case nil:
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// chunkTransformer applies a query's transform to a series that arrives a chunk at a time.  The last readable sample of
+// each chunk is carried into the next so differences across the boundary come out as they would for the whole
+// series, as does the running offset of an unwrap.
+type chunkTransformer struct {
+	qm         queryModel
+	has_prev   bool
+	prev_time  time.Time
+	prev_value float64
+	offset     float64
+}
+
+// apply transforms the next chunk of a series
+func (c *chunkTransformer) apply(times []time.Time, values []float64) ([]time.Time, []float64, error) {
+	if len(values) == 0 {
+		return times, values, nil
+	}
+
+	t, v := times, values
+	if c.has_prev {
+		t = append([]time.Time{c.prev_time}, times...)
+		v = append([]float64{c.prev_value}, values...)
+	}
+	// Carry the last readable sample, a chunk ending on a bad row would otherwise poison the start of the next one
+	for i := len(values) - 1; i >= 0; i-- {
+		if !math.IsNaN(values[i]) {
+			c.has_prev, c.prev_time, c.prev_value = true, times[i], values[i]
+			break
+		}
+	}
+
+	ttimes, tvalues, err := transformValues(t, v, c.qm)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The difference transforms already drop the first sample, the others map one to one
+	if len(tvalues) == len(v) && len(v) > len(values) {
+		ttimes, tvalues = ttimes[1:], tvalues[1:]
+	}
+
+	if c.qm.Transform == TRANSFORM_UNWRAP {
+		for i := range tvalues {
+			tvalues[i] += c.offset
+		}
+		for i := len(tvalues) - 1; i >= 0; i-- {
+			if !math.IsNaN(tvalues[i]) {
+				c.offset = tvalues[i] - values[i]
+				break
+			}
+		}
+	}
+
+	return ttimes, tvalues, nil
+}
+
+// streamKeyword reads a keyword's samples across a range a chunk at a time, converting and transforming numeric
+// keywords as a query would, and hands each processed chunk to emit.  Unreadable numeric values are either kept as
+// NaN or skipped.
+func streamKeyword(db *sql.DB, k exportKeyword, from time.Time, to time.Time, qm queryModel, keep bool, emit func([]exportSample) error) error {
+	sql_export := fmt.Sprintf("select time, trim(binvalue) from %s where keyword = $1 and time >= $2 and time <= $3 order by time asc;", pq.QuoteIdentifier(k.service))
+	rows, err := db.Query(sql_export, k.keyword, float64(from.UnixNano())*1e-9, float64(to.UnixNano())*1e-9)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	transformer := chunkTransformer{qm: qm}
+	times := make([]time.Time, 0, EXPORT_CHUNK_ROWS)
+	values := make([]float64, 0, EXPORT_CHUNK_ROWS)
+	texts := make([]string, 0, EXPORT_CHUNK_ROWS)
+	nulls := make([]bool, 0, EXPORT_CHUNK_ROWS)
+
+	flush := func() error {
+		samples := make([]exportSample, 0, len(times))
+		if k.numeric() {
+			ttimes, tvalues, err := transformer.apply(times, values)
+			if err != nil {
+				return err
+			}
+			for i := range ttimes {
+				samples = append(samples, exportSample{time: ttimes[i], value: tvalues[i], bad: math.IsNaN(tvalues[i])})
+			}
+		} else {
+			for i := range times {
+				samples = append(samples, exportSample{time: times[i], value: math.NaN(), text: texts[i], bad: nulls[i]})
+			}
+		}
+		times, values, texts, nulls = times[:0], values[:0], texts[:0], nulls[:0]
+
+		if len(samples) == 0 {
+			return nil
+		}
+		return emit(samples)
+	}
+
+	var timetemp float64
+	var valtemp sql.NullString
+	for rows.Next() {
+		err = rows.Scan(&timetemp, &valtemp)
+		if err != nil {
+			return err
+		}
+
+		if k.numeric() {
+			value, ok := parseNumber(valtemp)
+			if !ok && isBooleanType(k.keyword_type) {
+				if b, err := parseBoolean(valtemp.String); err == nil {
+					value, ok = 0, true
+					if b {
+						value = 1
+					}
+				}
+			}
+			if !ok {
+				if !keep {
+					continue
+				}
+				value = math.NaN()
+			}
+			if value, err = convertUnits(value, qm.UnitConversion); err != nil {
+				return err
+			}
+			values = append(values, value)
+		} else {
+			texts = append(texts, valtemp.String)
+			nulls = append(nulls, !valtemp.Valid)
+		}
+		times = append(times, unixToTime(timetemp))
+
+		if len(times) == EXPORT_CHUNK_ROWS {
+			if err = flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+// exportFilename names the download after the keyword, or after the export as a whole for several
+func exportFilename(keywords []exportKeyword, extension string) string {
+	if len(keywords) == 1 {
+		return keywords[0].name() + "." + extension
+	}
+	return "keywords." + extension
+}
+
+// flushResponse pushes what has been written so far out to the caller as a chunk
+func flushResponse(rw http.ResponseWriter) {
+	if flusher, ok := rw.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// formatExportTime writes a sample time in one of the EXPORT_TIME_* styles
+func formatExportTime(t time.Time, style string) string {
+	if style == EXPORT_TIME_UNIX {
+		return strconv.FormatFloat(float64(t.UnixNano())*1e-9, 'f', -1, 64)
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// writeDelimited streams the export as delimited text, a keyword column is added when there is more than one
+func writeDelimited(db *sql.DB, w io.Writer, request exportRequest, comma rune, style string, flush func() error) error {
+	out := csv.NewWriter(w)
+	out.Comma = comma
+
+	multiple := len(request.keywords) > 1
+	header := []string{"time", "value"}
+	if multiple {
+		header = []string{"time", "keyword", "value"}
+	}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+
+	for _, k := range request.keywords {
+		err := streamKeyword(db, k, request.from, request.to, request.qm, false, func(samples []exportSample) error {
+			for _, sample := range samples {
+				value := sample.text
+				if k.numeric() {
+					value = strconv.FormatFloat(sample.value, 'g', -1, 64)
+				}
+
+				record := []string{formatExportTime(sample.time, style), value}
+				if multiple {
+					record = []string{record[0], k.name(), value}
+				}
+				if err := out.Write(record); err != nil {
+					return err
+				}
+			}
+
+			out.Flush()
+			if err := out.Error(); err != nil {
+				return err
+			}
+			return flush()
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+// handleResourceExport answers /export?keywords=S.K,...&from=T&to=T&format=csv|tsv|arrow|parquet|fits, with gzip=true,
+// time=iso|unix and the query processing options, by streaming the raw keyword history as a file
+func (ds *KeywordDatasource) handleResourceExport(rw http.ResponseWriter, req *http.Request) {
+	params, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		writeError(rw, badRequest(err))
+		return
+	}
+	request, err := parseExportRequest(params)
+	if err != nil {
+		writeError(rw, badRequest(err))
+		return
+	}
+
+	format := params.Get("format")
+	comma, content_type, extension := ',', "text/csv", EXPORT_FORMAT_CSV
+	switch format {
+	case "", EXPORT_FORMAT_CSV:
+		format = EXPORT_FORMAT_CSV
+	case EXPORT_FORMAT_TSV:
+		comma, content_type, extension = '\t', "text/tab-separated-values", EXPORT_FORMAT_TSV
+	case EXPORT_FORMAT_ARROW:
+		content_type, extension = "application/vnd.apache.arrow.stream", "arrows"
+	case EXPORT_FORMAT_PARQUET:
+		content_type, extension = "application/vnd.apache.parquet", "parquet"
+	case EXPORT_FORMAT_FITS:
+		content_type, extension = "application/fits", "fits"
+	default:
+		writeError(rw, badRequest(fmt.Errorf("unknown export format: %q, expected csv, tsv, arrow, parquet or fits", format)))
+		return
+	}
+
+	style := params.Get("time")
+	if style == "" {
+		style = EXPORT_TIME_ISO
+	}
+	if style != EXPORT_TIME_ISO && style != EXPORT_TIME_UNIX {
+		writeError(rw, badRequest(fmt.Errorf("unknown time style: %q, expected iso or unix", style)))
+		return
+	}
+
+	compress, err := boolParam(params, "gzip")
+	if err != nil {
+		writeError(rw, badRequest(err))
+		return
+	}
+
+	cfg, db, err := openResourceDatabase(req)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	defer db.Close()
+
+	err = loadExportTypes(db, cfg, request.keywords)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+
+	// The columnar and FITS formats carry the keyword metadata in their schema or headers
+	var metadata []*keywordMetadata
+	if format == EXPORT_FORMAT_ARROW || format == EXPORT_FORMAT_PARQUET || format == EXPORT_FORMAT_FITS {
+		metadata, err = loadExportMetadata(db, cfg, request.keywords)
+		if err != nil {
+			writeError(rw, err)
+			return
+		}
+	}
+
+	filename := exportFilename(request.keywords, extension)
+	if compress {
+		filename, content_type = filename+".gz", "application/gzip"
+	}
+	rw.Header().Set("Content-Type", content_type)
+	rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	rw.WriteHeader(http.StatusOK)
+
+	var w io.Writer = rw
+	flush := func() error {
+		flushResponse(rw)
+		return nil
+	}
+	if compress {
+		zw := gzip.NewWriter(rw)
+		defer zw.Close()
+		w = zw
+		flush = func() error {
+			err := zw.Flush()
+			flushResponse(rw)
+			return err
+		}
+	}
+
+	// The status has gone out with the first chunk, all that can be done now is to stop and log it
+	switch format {
+	case EXPORT_FORMAT_ARROW:
+		err = writeArrow(db, w, request, metadata, flush)
+	case EXPORT_FORMAT_PARQUET:
+		err = writeParquet(db, w, request, metadata, flush)
+	case EXPORT_FORMAT_FITS:
+		err = writeFits(db, w, request, metadata, flush)
+	default:
+		err = writeDelimited(db, w, request, comma, style, flush)
+	}
+	if err != nil {
+		log.DefaultLogger.Error(fl() + "export error: " + err.Error())
+	}
+}
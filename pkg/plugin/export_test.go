@@ -0,0 +1,127 @@
+package plugin
+
+import (
+	"math"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestChunkTransformer(t *testing.T) {
+	t0 := time.Unix(1700000000, 0).UTC()
+	values := []float64{350, 355, 2, 8, 15, 358, 5, 9, 1, 359}
+	times := make([]time.Time, len(values))
+	for i := range values {
+		times[i] = t0.Add(time.Duration(i*(i+1)) * time.Second)
+	}
+
+	transforms := []queryModel{
+		{Transform: TRANSFORM_NONE},
+		{Transform: TRANSFORM_DELTA},
+		{Transform: TRANSFORM_FIRST_DERIVATVE},
+		{Transform: TRANSFORM_FIRST_DERIVATVE, UnwrapFirst: true},
+		{Transform: TRANSFORM_UNWRAP},
+		{Transform: TRANSFORM_NORMALIZE, WrapInterval: WRAP_INTERVAL_SIGNED},
+	}
+
+	for _, qm := range transforms {
+		wtimes, wvalues, err := transformValues(times, values, qm)
+		if err != nil {
+			t.Fatalf("transform %d: unexpected error %v", qm.Transform, err)
+		}
+
+		// Feed the same series through in uneven chunks and expect the same result
+		transformer := chunkTransformer{qm: qm}
+		ctimes, cvalues := []time.Time{}, []float64{}
+		for _, bounds := range [][2]int{{0, 3}, {3, 4}, {4, 9}, {9, 10}} {
+			ct, cv, err := transformer.apply(times[bounds[0]:bounds[1]], values[bounds[0]:bounds[1]])
+			if err != nil {
+				t.Fatalf("transform %d: unexpected error %v", qm.Transform, err)
+			}
+			ctimes, cvalues = append(ctimes, ct...), append(cvalues, cv...)
+		}
+
+		if len(cvalues) != len(wvalues) {
+			t.Fatalf("transform %d: expected %d values, got %d", qm.Transform, len(wvalues), len(cvalues))
+		}
+		for i := range wvalues {
+			if !ctimes[i].Equal(wtimes[i]) || math.Abs(cvalues[i]-wvalues[i]) > 1e-9 {
+				t.Errorf("transform %d: value %d expected %v at %s, got %v at %s", qm.Transform, i, wvalues[i], wtimes[i], cvalues[i], ctimes[i])
+			}
+		}
+	}
+}
+
+func TestChunkTransformerBadRows(t *testing.T) {
+	t0 := time.Unix(1700000000, 0).UTC()
+	times := make([]time.Time, 5)
+	for i := range times {
+		times[i] = t0.Add(time.Duration(i) * time.Second)
+	}
+
+	// The first chunk ends on an unreadable row, the wrap in the second chunk is measured from the last good value
+	transformer := chunkTransformer{qm: queryModel{Transform: TRANSFORM_UNWRAP}}
+	_, first, err := transformer.apply(times[:3], []float64{350, 355, math.NaN()})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	_, second, err := transformer.apply(times[3:], []float64{5, 10})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !math.IsNaN(first[2]) || len(second) != 2 || second[0] != 365 || second[1] != 370 {
+		t.Errorf("unexpected unwrapped values %v %v", first, second)
+	}
+
+	// Differences across the boundary are taken from the last good sample
+	transformer = chunkTransformer{qm: queryModel{Transform: TRANSFORM_DELTA}}
+	transformer.apply(times[:3], []float64{1, 2, math.NaN()})
+	_, second, _ = transformer.apply(times[3:], []float64{5, 6})
+	if len(second) != 2 || second[0] != 3 || second[1] != 1 {
+		t.Errorf("unexpected deltas %v", second)
+	}
+}
+
+func TestParseExportRequest(t *testing.T) {
+	params := url.Values{
+		"keywords":  {"dcs.AZ, dcs.EL"},
+		"from":      {"1700000000"},
+		"to":        {"1700003600"},
+		"transform": {"3"},
+	}
+
+	request, err := parseExportRequest(params)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(request.keywords) != 2 || request.keywords[1].name() != "dcs.EL" {
+		t.Errorf("unexpected keywords %v", request.keywords)
+	}
+	if request.to.Sub(request.from) != time.Hour || request.qm.Transform != 3 {
+		t.Errorf("unexpected range or transform")
+	}
+
+	bad := []url.Values{
+		{},
+		{"keywords": {"AZ"}},
+		{"keywords": {"dcs.AZ"}, "transform": {"99"}},
+		{"keywords": {"dcs.AZ"}, "unitConversion": {"x"}},
+		{"keywords": {"dcs.AZ"}, "from": {"1700003600"}, "to": {"1700000000"}},
+	}
+	for _, params := range bad {
+		if _, err := parseExportRequest(params); err == nil {
+			t.Errorf("expected an error for %v", params)
+		}
+	}
+}
+
+func TestFormatExportTime(t *testing.T) {
+	at := time.Unix(1700000000, 500000000)
+
+	if s := formatExportTime(at, EXPORT_TIME_ISO); s != "2023-11-14T22:13:20.5Z" {
+		t.Errorf("unexpected ISO time %q", s)
+	}
+	if s := formatExportTime(at, EXPORT_TIME_UNIX); s != "1700000000.5" {
+		t.Errorf("unexpected Unix time %q", s)
+	}
+}
@@ -0,0 +1,405 @@
+package plugin
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Define the FITS export format
+const EXPORT_FORMAT_FITS = "fits"
+
+// FITS files are written in blocks of 36 cards of 80 characters
+const (
+	FITS_BLOCK = 2880
+	FITS_CARD  = 80
+)
+
+// Modified Julian Date of the Unix epoch
+const MJD_UNIX_EPOCH = 40587.0
+
+// UTC times are written to microseconds, 26 characters
+const FITS_TIME_LAYOUT = "2006-01-02T15:04:05.000000"
+
+// Sample quality flags, the value is undefined when it couldn't be read or computed
+const (
+	FITS_QUALITY_GOOD      = 0
+	FITS_QUALITY_UNDEFINED = 1
+)
+
+// unixToMJD converts a time to a Modified Julian Date
+func unixToMJD(t time.Time) float64 {
+	return float64(t.UnixNano())*1e-9/86400 + MJD_UNIX_EPOCH
+}
+
+// Room for a quoted string value between column 11 and the end of the card, less the quotes
+const FITS_STRING_WIDTH = FITS_CARD - 10 - 2
+
+// fitsText reduces a string to the printable ASCII a header allows, anything else becomes '?'
+func fitsText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r < ' ' || r > '~' {
+			r = '?'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// fitsSplit cuts a string into pieces that fit the given width once embedded quotes are doubled, the cut is made on
+// the raw text so a doubled quote is never split.  The pieces are returned escaped.
+func fitsSplit(s string, width int) []string {
+	pieces := []string{}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		escaped := s[i : i+1]
+		if escaped == "'" {
+			escaped = "''"
+		}
+		if b.Len()+len(escaped) > width {
+			pieces = append(pieces, b.String())
+			b.Reset()
+		}
+		b.WriteString(escaped)
+	}
+	return append(pieces, b.String())
+}
+
+// fitsValue formats a header card value: logicals and numbers right justified to column 30, strings quoted from
+// column 11 with embedded quotes doubled and cut short to fit the card
+func fitsValue(value interface{}) string {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return fmt.Sprintf("%20s", "T")
+		}
+		return fmt.Sprintf("%20s", "F")
+	case int:
+		return fmt.Sprintf("%20d", v)
+	case int64:
+		return fmt.Sprintf("%20d", v)
+	case float64:
+		s := strconv.FormatFloat(v, 'G', -1, 64)
+		if !strings.ContainsAny(s, ".E") {
+			s += ".0"
+		}
+		return fmt.Sprintf("%20s", s)
+	default:
+		return fmt.Sprintf("'%-8s'", fitsSplit(fitsText(fmt.Sprint(v)), FITS_STRING_WIDTH)[0])
+	}
+}
+
+// fitsCardText pads a card to 80 characters, the comment is cut short if there isn't room for it
+func fitsCardText(card string, comment string) string {
+	if comment != "" && len(card) < FITS_CARD-3 {
+		card += " / " + comment
+	}
+	if len(card) > FITS_CARD {
+		card = card[:FITS_CARD]
+	}
+	return fmt.Sprintf("%-80s", card)
+}
+
+// fitsCard formats one 80 character header card
+func fitsCard(keyword string, value interface{}, comment string) string {
+	return fitsCardText(fmt.Sprintf("%-8s= %s", keyword, fitsValue(value)), comment)
+}
+
+// fitsLongCards formats a string too long for one card using the OGIP long string convention: each piece but the
+// last ends in '&' and the rest follow on CONTINUE cards, the comment goes on the last
+func fitsLongCards(keyword string, value string, comment string) []string {
+	pieces := fitsSplit(fitsText(value), FITS_STRING_WIDTH-1)
+	cards := make([]string, len(pieces))
+	for i, piece := range pieces {
+		prefix, card_comment := fmt.Sprintf("%-8s= ", keyword), ""
+		if i > 0 {
+			prefix = "CONTINUE  "
+		}
+		if i < len(pieces)-1 {
+			piece += "&"
+		} else {
+			card_comment = comment
+		}
+		cards[i] = fitsCardText(prefix+"'"+piece+"'", card_comment)
+	}
+	return cards
+}
+
+// fitsHeader collects the cards of one header unit
+type fitsHeader []string
+
+// add appends a card to the header, continuing strings that don't fit on one
+func (h *fitsHeader) add(keyword string, value interface{}, comment string) {
+	if s, ok := value.(string); ok && len(fitsSplit(fitsText(s), FITS_STRING_WIDTH)) > 1 {
+		*h = append(*h, fitsLongCards(keyword, s, comment)...)
+		return
+	}
+	*h = append(*h, fitsCard(keyword, value, comment))
+}
+
+// bytes ends the header and pads it with spaces to a whole block
+func (h fitsHeader) bytes() []byte {
+	s := strings.Join(h, "") + fmt.Sprintf("%-80s", "END")
+	if pad := len(s) % FITS_BLOCK; pad != 0 {
+		s += strings.Repeat(" ", FITS_BLOCK-pad)
+	}
+	return []byte(s)
+}
+
+// fitsPadding is the zero fill that brings a data unit of the given size to a whole block
+func fitsPadding(size int64) []byte {
+	if pad := size % FITS_BLOCK; pad != 0 {
+		return make([]byte, FITS_BLOCK-pad)
+	}
+	return nil
+}
+
+// fitsPrimaryHeader is the header of the empty primary unit, recording the export as a whole
+func fitsPrimaryHeader(request exportRequest, now time.Time) fitsHeader {
+	names := make([]string, len(request.keywords))
+	for i, k := range request.keywords {
+		names[i] = k.name()
+	}
+
+	h := fitsHeader{}
+	h.add("SIMPLE", true, "conforms to FITS standard")
+	h.add("BITPIX", 8, "")
+	h.add("NAXIS", 0, "no primary data, one table per keyword follows")
+	h.add("EXTEND", true, "")
+	h.add("LONGSTRN", "OGIP 1.0", "long strings continue on CONTINUE cards")
+	h.add("ORIGIN", "wmko-keyword-datasource", "")
+	h.add("DATE", now.UTC().Format("2006-01-02T15:04:05"), "file creation time (UTC)")
+	h.add("TIMESYS", "UTC", "")
+	h.add("DATE-BEG", request.from.UTC().Format(FITS_TIME_LAYOUT), "start of query range")
+	h.add("DATE-END", request.to.UTC().Format(FITS_TIME_LAYOUT), "end of query range")
+	h.add("MJD-BEG", unixToMJD(request.from), "")
+	h.add("MJD-END", unixToMJD(request.to), "")
+	h.add("NKEYWORD", len(request.keywords), "number of keyword tables")
+	h.add("KEYWORDS", strings.Join(names, ","), "")
+	h.add("UNITCONV", request.qm.UnitConversion, "unit conversion applied")
+	h.add("TRANSFRM", request.qm.Transform, "transform applied")
+	return h
+}
+
+// fitsTableHeader is the header of one keyword's binary table, value is its TFORM
+func fitsTableHeader(request exportRequest, k exportKeyword, metadata *keywordMetadata, rows int64, width int) fitsHeader {
+	value_form, value_bytes := "1D", 8
+	if !k.numeric() {
+		value_form, value_bytes = fmt.Sprintf("%dA", width), width
+	}
+
+	units, description := "", ""
+	if metadata != nil {
+		units, description = metadata.Units, metadata.Description
+	}
+
+	h := fitsHeader{}
+	h.add("XTENSION", "BINTABLE", "binary table extension")
+	h.add("BITPIX", 8, "")
+	h.add("NAXIS", 2, "")
+	h.add("NAXIS1", 8+len(FITS_TIME_LAYOUT)+value_bytes+1, "bytes per row")
+	h.add("NAXIS2", rows, "number of samples")
+	h.add("PCOUNT", 0, "")
+	h.add("GCOUNT", 1, "")
+	h.add("TFIELDS", 4, "")
+	h.add("TTYPE1", "MJD", "sample time")
+	h.add("TFORM1", "1D", "")
+	h.add("TUNIT1", "d", "")
+	h.add("TTYPE2", "UTC", "sample time, ISO 8601")
+	h.add("TFORM2", fmt.Sprintf("%dA", len(FITS_TIME_LAYOUT)), "")
+	h.add("TTYPE3", "VALUE", "")
+	h.add("TFORM3", value_form, "")
+	if units != "" {
+		h.add("TUNIT3", units, "")
+	}
+	h.add("TTYPE4", "QUALITY", "0 good, 1 undefined")
+	h.add("TFORM4", "1B", "")
+	h.add("EXTNAME", k.name(), "")
+	h.add("SERVICE", k.service, "")
+	h.add("KEYWORD", k.keyword, "")
+	h.add("KTLTYPE", k.keyword_type, "")
+	if units != "" {
+		h.add("UNITS", units, "")
+	}
+	if description != "" {
+		h.add("DESCRIP", description, "")
+	}
+	h.add("TIMESYS", "UTC", "")
+	h.add("DATE-BEG", request.from.UTC().Format(FITS_TIME_LAYOUT), "start of query range")
+	h.add("DATE-END", request.to.UTC().Format(FITS_TIME_LAYOUT), "end of query range")
+	return h
+}
+
+// fitsSpool holds a keyword's samples in a temporary file while they're counted, a FITS table header has to give
+// the number of rows (and the width of a string column) before any of them
+type fitsSpool struct {
+	file  *os.File
+	w     *bufio.Writer
+	rows  int64
+	width int
+}
+
+// newFitsSpool creates an empty spool, the caller closes it
+func newFitsSpool() (*fitsSpool, error) {
+	file, err := os.CreateTemp("", "keyword-export-*.spool")
+	if err != nil {
+		return nil, err
+	}
+	return &fitsSpool{file: file, w: bufio.NewWriter(file), width: 1}, nil
+}
+
+// add spools a chunk of samples: time in ns, value, the bad flag and the length prefixed text.  Character columns
+// only hold printable ASCII, so the text is reduced to it here where the column width is worked out.
+func (s *fitsSpool) add(samples []exportSample) error {
+	for _, sample := range samples {
+		text := fitsText(sample.text)
+		record := []interface{}{sample.time.UnixNano(), sample.value, sample.bad, uint32(len(text))}
+		for _, field := range record {
+			if err := binary.Write(s.w, binary.BigEndian, field); err != nil {
+				return err
+			}
+		}
+		if _, err := s.w.WriteString(text); err != nil {
+			return err
+		}
+
+		s.rows++
+		if len(text) > s.width {
+			s.width = len(text)
+		}
+	}
+	return nil
+}
+
+// rewind finishes spooling and returns a reader of the samples from the start
+func (s *fitsSpool) rewind() (io.Reader, error) {
+	if err := s.w.Flush(); err != nil {
+		return nil, err
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return bufio.NewReader(s.file), nil
+}
+
+// close removes the spool file
+func (s *fitsSpool) close() {
+	s.file.Close()
+	os.Remove(s.file.Name())
+}
+
+// writeFitsRows converts spooled samples to big endian table rows, flushing every chunk
+func writeFitsRows(w io.Writer, r io.Reader, k exportKeyword, rows int64, width int, flush func() error) (int64, error) {
+	var written int64
+	text := make([]byte, width)
+
+	for row := int64(1); row <= rows; row++ {
+		var ns int64
+		var value float64
+		var bad bool
+		var length uint32
+		for _, field := range []interface{}{&ns, &value, &bad, &length} {
+			if err := binary.Read(r, binary.BigEndian, field); err != nil {
+				return written, err
+			}
+		}
+		raw := make([]byte, length)
+		if _, err := io.ReadFull(r, raw); err != nil {
+			return written, err
+		}
+
+		t := time.Unix(0, ns).UTC()
+		quality := uint8(FITS_QUALITY_GOOD)
+		if bad {
+			quality = FITS_QUALITY_UNDEFINED
+		}
+
+		record := []interface{}{unixToMJD(t), []byte(t.Format(FITS_TIME_LAYOUT))}
+		if k.numeric() {
+			record = append(record, value)
+		} else {
+			// Strings are space padded to the column width
+			copy(text, raw)
+			for i := len(raw); i < width; i++ {
+				text[i] = ' '
+			}
+			record = append(record, text)
+		}
+		record = append(record, quality)
+
+		for _, field := range record {
+			if err := binary.Write(w, binary.BigEndian, field); err != nil {
+				return written, err
+			}
+			written += int64(binary.Size(field))
+		}
+
+		if row%EXPORT_CHUNK_ROWS == 0 {
+			if err := flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+
+	return written, nil
+}
+
+// writeFitsTable spools one keyword's samples and writes them out as a binary table extension
+func writeFitsTable(db *sql.DB, w io.Writer, request exportRequest, k exportKeyword, metadata *keywordMetadata, flush func() error) error {
+	spool, err := newFitsSpool()
+	if err != nil {
+		return err
+	}
+	defer spool.close()
+
+	err = streamKeyword(db, k, request.from, request.to, request.qm, true, spool.add)
+	if err != nil {
+		return err
+	}
+	r, err := spool.rewind()
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(fitsTableHeader(request, k, metadata, spool.rows, spool.width).bytes())
+	if err != nil {
+		return err
+	}
+	size, err := writeFitsRows(w, r, k, spool.rows, spool.width, flush)
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(fitsPadding(size)); err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+// writeFits writes the export as a FITS file: an empty primary unit recording the query followed by a BINTABLE per
+// keyword with MJD, UTC, value and quality columns
+func writeFits(db *sql.DB, w io.Writer, request exportRequest, metadata []*keywordMetadata, flush func() error) error {
+	_, err := w.Write(fitsPrimaryHeader(request, time.Now()).bytes())
+	if err != nil {
+		return err
+	}
+
+	for i, k := range request.keywords {
+		var m *keywordMetadata
+		if i < len(metadata) {
+			m = metadata[i]
+		}
+		if err = writeFitsTable(db, w, request, k, m, flush); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
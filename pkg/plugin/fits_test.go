@@ -0,0 +1,195 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFitsCard(t *testing.T) {
+	cases := []struct {
+		keyword  string
+		value    interface{}
+		comment  string
+		expected string
+	}{
+		{"SIMPLE", true, "", "SIMPLE  =                    T"},
+		{"NAXIS2", int64(42), "rows", "NAXIS2  =                   42 / rows"},
+		{"MJD-BEG", 60000.0, "", "MJD-BEG =              60000.0"},
+		{"EXTNAME", "dcs.AZ", "", "EXTNAME = 'dcs.AZ  '"},
+		{"DESCRIP", "it's", "", "DESCRIP = 'it''s   '"},
+	}
+
+	for _, c := range cases {
+		card := fitsCard(c.keyword, c.value, c.comment)
+		if len(card) != FITS_CARD {
+			t.Errorf("%s: card is %d characters", c.keyword, len(card))
+		}
+		if strings.TrimRight(card, " ") != c.expected {
+			t.Errorf("%s: expected %q, got %q", c.keyword, c.expected, strings.TrimRight(card, " "))
+		}
+	}
+
+	if card := fitsCard("DESCRIP", strings.Repeat("x", 100), "long"); len(card) != FITS_CARD || !strings.HasSuffix(strings.TrimRight(card, " "), "'") {
+		t.Errorf("unexpected long string card %q", card)
+	}
+}
+
+func TestFitsStrings(t *testing.T) {
+	// Cutting a string short never leaves half of a doubled quote
+	card := strings.TrimRight(fitsCard("DESCRIP", strings.Repeat("x", 67)+"'s", ""), " ")
+	if !strings.HasSuffix(card, strings.Repeat("x", 67)+"'") {
+		t.Errorf("unexpected cut string card %q", card)
+	}
+
+	if card := fitsCard("DESCRIP", "10 µm ± 2", ""); strings.TrimRight(card, " ") != "DESCRIP = '10 ?m ? 2'" {
+		t.Errorf("unexpected non-ASCII card %q", card)
+	}
+
+	// A long value continues over CONTINUE cards, all of it kept
+	value := strings.Repeat("dcs.AZ,", 30) + "it's"
+	h := fitsHeader{}
+	h.add("KEYWORDS", value, "keywords")
+	if len(h) < 3 || !strings.HasPrefix(h[0], "KEYWORDS= '") || !strings.HasPrefix(h[1], "CONTINUE  '") {
+		t.Fatalf("unexpected long string cards %q", h)
+	}
+	joined := ""
+	for i, card := range h {
+		if len(card) != FITS_CARD {
+			t.Errorf("card %d is %d characters", i, len(card))
+		}
+		piece := strings.TrimRight(card[10:], " ")
+		if i == len(h)-1 {
+			if !strings.HasSuffix(piece, "/ keywords") {
+				t.Errorf("expected the comment on the last card %q", card)
+			}
+			piece = strings.TrimSuffix(piece, " / keywords")
+		} else if !strings.HasSuffix(piece, "&'") {
+			t.Errorf("expected card %d to continue %q", i, card)
+		}
+		joined += strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(piece, "'"), "'"), "&")
+	}
+	if strings.ReplaceAll(joined, "''", "'") != value {
+		t.Errorf("continued value doesn't match, got %q", joined)
+	}
+}
+
+func TestFitsHeader(t *testing.T) {
+	request := exportRequest{
+		keywords: []exportKeyword{{service: "dcs", keyword: "AZ", keyword_type: "KTL_DOUBLE"}},
+		from:     time.Unix(1700000000, 0),
+		to:       time.Unix(1700003600, 0),
+	}
+	header := fitsTableHeader(request, request.keywords[0], &keywordMetadata{Units: "deg"}, 10, 1).bytes()
+
+	if len(header)%FITS_BLOCK != 0 {
+		t.Errorf("header is %d bytes, not whole blocks", len(header))
+	}
+	for _, card := range []string{"XTENSION= 'BINTABLE'", "NAXIS1  =                   43", "TUNIT3  = 'deg     '", "EXTNAME = 'dcs.AZ  '", "END"} {
+		if !strings.Contains(string(header), card) {
+			t.Errorf("expected card %q", card)
+		}
+	}
+
+	if mjd := unixToMJD(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)); mjd != 51544 {
+		t.Errorf("unexpected MJD %v", mjd)
+	}
+	if pad := fitsPadding(FITS_BLOCK + 1); len(pad) != FITS_BLOCK-1 {
+		t.Errorf("unexpected padding %d", len(pad))
+	}
+}
+
+func TestFitsRows(t *testing.T) {
+	t0 := time.Unix(1700000000, 0).UTC()
+
+	cases := []struct {
+		k       exportKeyword
+		samples []exportSample
+		width   int
+	}{
+		{exportKeyword{keyword_type: "KTL_DOUBLE"}, []exportSample{{time: t0, value: 1.5}, {time: t0.Add(time.Second), value: math.NaN(), bad: true}}, 1},
+		{exportKeyword{keyword_type: "KTL_STRING"}, []exportSample{{time: t0, text: "Open"}, {time: t0, text: "Closed"}}, 6},
+	}
+
+	for _, c := range cases {
+		spool, err := newFitsSpool()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer spool.close()
+
+		if err = spool.add(c.samples); err != nil {
+			t.Fatal(err)
+		}
+		if spool.rows != int64(len(c.samples)) || spool.width != c.width {
+			t.Fatalf("unexpected spool of %d rows %d wide", spool.rows, spool.width)
+		}
+		r, err := spool.rewind()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var buf bytes.Buffer
+		size, err := writeFitsRows(&buf, r, c.k, spool.rows, spool.width, func() error { return nil })
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		row := 8 + len(FITS_TIME_LAYOUT) + 1
+		if c.k.numeric() {
+			row += 8
+		} else {
+			row += c.width
+		}
+		if size != int64(row*len(c.samples)) || buf.Len() != int(size) {
+			t.Fatalf("expected %d bytes, wrote %d", row*len(c.samples), size)
+		}
+
+		data := buf.Bytes()
+		if mjd := math.Float64frombits(binary.BigEndian.Uint64(data[0:8])); mjd != unixToMJD(t0) {
+			t.Errorf("unexpected MJD %v", mjd)
+		}
+		if utc := string(data[8 : 8+len(FITS_TIME_LAYOUT)]); utc != "2023-11-14T22:13:20.000000" {
+			t.Errorf("unexpected UTC %q", utc)
+		}
+		if c.k.numeric() {
+			if quality := data[2*row-1]; quality != FITS_QUALITY_UNDEFINED {
+				t.Errorf("expected the unreadable row flagged, got %d", quality)
+			}
+		} else if text := string(data[8+len(FITS_TIME_LAYOUT) : 8+len(FITS_TIME_LAYOUT)+c.width]); text != "Open  " {
+			t.Errorf("unexpected padded text %q", text)
+		}
+	}
+}
+
+func TestFitsRowsASCII(t *testing.T) {
+	spool, err := newFitsSpool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.close()
+
+	t0 := time.Unix(1700000000, 0).UTC()
+	if err = spool.add([]exportSample{{time: t0, text: "10 µm ±2"}}); err != nil {
+		t.Fatal(err)
+	}
+	if spool.width != 8 {
+		t.Fatalf("expected the width of the ASCII text, got %d", spool.width)
+	}
+	r, err := spool.rewind()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err = writeFitsRows(&buf, r, exportKeyword{keyword_type: "KTL_STRING"}, spool.rows, spool.width, func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	start := 8 + len(FITS_TIME_LAYOUT)
+	if text := string(buf.Bytes()[start : start+spool.width]); text != "10 ?m ?2" {
+		t.Errorf("unexpected text %q", text)
+	}
+}
@@ -0,0 +1,243 @@
+package plugin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Define the response formats, this maps onto the formatOptions list in QueryEditor.tsx
+const (
+	FORMAT_TIME_SERIES = "time_series"
+	FORMAT_TABLE       = "table"
+	FORMAT_WIDE        = "wide"
+)
+
+// rawTexts is the archived text of each sample by sample time (ns).  Samples can share a time, so each time holds
+// its texts in sample order.
+type rawTexts map[int64][]string
+
+// add records the archived text of the next sample
+func (r rawTexts) add(t time.Time, text string) {
+	r[t.UnixNano()] = append(r[t.UnixNano()], text)
+}
+
+// formatFrame reshapes a keyword frame, one time field plus one or more value fields, into the requested format.
+// Numeric time series frames are typed so panels know what they are getting.  The long table has a row per sample per
+// value field with the raw archived text alongside.  raw may be nil when there is no archive (computed values), in
+// which case the value is formatted instead; a row without archived text of its own gets a null.  The wide table is
+// the frame as is, time first.
+func formatFrame(frame *data.Frame, format string, service string, keyword string, raw rawTexts) (*data.Frame, error) {
+
+	// Heatmaps already have their own shape
+	if frame.Meta != nil && frame.Meta.Type == FRAME_TYPE_HEATMAP_CELLS {
+		return frame, nil
+	}
+
+	timeIndex := -1
+	for i, field := range frame.Fields {
+		if field.Type() == data.FieldTypeTime {
+			timeIndex = i
+			break
+		}
+	}
+	if timeIndex < 0 {
+		return nil, fmt.Errorf("frame has no time field")
+	}
+
+	switch format {
+
+	case "", FORMAT_TIME_SERIES:
+		// Only numbers make a time series, strings and booleans are left as a table for the state timeline
+		frameType := data.FrameTypeTimeSeriesMulti
+		if len(frame.Fields) > 2 {
+			frameType = data.FrameTypeTimeSeriesWide
+		}
+		for i, field := range frame.Fields {
+			if i != timeIndex && !field.Type().Numeric() {
+				frameType = data.FrameTypeTable
+				break
+			}
+		}
+		setFrameType(frame, frameType)
+		return frame, nil
+
+	case FORMAT_WIDE:
+		// Put time first and give every column a name of its own for the table panel and CSV export
+		fields := []*data.Field{frame.Fields[timeIndex]}
+		for i, field := range frame.Fields {
+			if i == timeIndex {
+				continue
+			}
+			field.Name = columnName(service+"."+keyword, field.Name)
+			fields = append(fields, field)
+		}
+		frame.Fields = fields
+		setFrameType(frame, data.FrameTypeTable)
+		return frame, nil
+
+	case FORMAT_TABLE:
+		return longTable(frame, timeIndex, service, keyword, raw), nil
+
+	default:
+		return nil, fmt.Errorf("Unknown format: %s", format)
+	}
+}
+
+// setFrameType marks a frame with its data plane type, keeping any other metadata it already has
+func setFrameType(frame *data.Frame, frameType data.FrameType) {
+	if frame.Meta == nil {
+		frame.Meta = &data.FrameMeta{}
+	}
+	frame.Meta.Type = frameType
+	frame.Meta.TypeVersion = data.FrameTypeVersion{0, 1}
+}
+
+// columnName names a value column after its keyword, with the field's own name (a bit or element) added on
+func columnName(keyword string, name string) string {
+	switch {
+	case name == "":
+		return keyword
+	case strings.HasPrefix(name, "["):
+		return keyword + name
+	default:
+		return keyword + ":" + name
+	}
+}
+
+// longTable flattens a frame into time, service, keyword, value and raw value columns.  Numeric and boolean values
+// share a numeric value column, strings get a string one.
+func longTable(frame *data.Frame, timeIndex int, service string, keyword string, raw rawTexts) *data.Frame {
+	times := []time.Time{}
+	services := []string{}
+	keywords := []string{}
+	numbers := []*float64{}
+	texts := []*string{}
+	raws := []*string{}
+
+	// How many of the texts at each time have been matched to rows so far
+	used := map[int64]int{}
+
+	numeric := true
+	for i, field := range frame.Fields {
+		if i != timeIndex && field.Type().NonNullableType() == data.FieldTypeString {
+			numeric = false
+		}
+	}
+
+	timeField := frame.Fields[timeIndex]
+	for row := 0; row < timeField.Len(); row++ {
+		t := timeField.At(row).(time.Time)
+
+		var archived *string
+		if raw != nil {
+			if n := used[t.UnixNano()]; n < len(raw[t.UnixNano()]) {
+				archived = &raw[t.UnixNano()][n]
+			}
+			used[t.UnixNano()]++
+		}
+
+		for i, field := range frame.Fields {
+			if i == timeIndex {
+				continue
+			}
+
+			value, ok := field.ConcreteAt(row)
+			var number *float64
+			var text *string
+			if ok {
+				switch v := value.(type) {
+				case float64:
+					number = &v
+				case bool:
+					b := 0.0
+					if v {
+						b = 1
+					}
+					number = &b
+				case string:
+					text = &v
+				}
+			}
+
+			// Use the archived text, without an archive format the value
+			rawText := archived
+			if raw == nil {
+				switch {
+				case number != nil:
+					formatted := strconv.FormatFloat(*number, 'g', -1, 64)
+					rawText = &formatted
+				case text != nil:
+					rawText = text
+				}
+			}
+
+			times = append(times, t)
+			services = append(services, service)
+			keywords = append(keywords, columnName(keyword, field.Name))
+			raws = append(raws, rawText)
+
+			if numeric {
+				numbers = append(numbers, number)
+			} else {
+				// A string table may still have a numeric column in it, keep its values as text
+				if text == nil && number != nil {
+					formatted := strconv.FormatFloat(*number, 'g', -1, 64)
+					text = &formatted
+				}
+				texts = append(texts, text)
+			}
+		}
+	}
+
+	table := data.NewFrame(frame.Name,
+		data.NewField("time", nil, times),
+		data.NewField("service", nil, services),
+		data.NewField("keyword", nil, keywords),
+	)
+	if numeric {
+		table.Fields = append(table.Fields, data.NewField("value", nil, numbers))
+	} else {
+		table.Fields = append(table.Fields, data.NewField("value", nil, texts))
+	}
+	table.Fields = append(table.Fields, data.NewField("raw value", nil, raws))
+
+	table.RefID = frame.RefID
+	table.Meta = frame.Meta
+	setFrameType(table, data.FrameTypeTable)
+
+	return table
+}
+
+// formattedResponse reshapes a finished frame into the query's format and adds it to the response
+func formattedResponse(response backend.DataResponse, frame *data.Frame, query backend.DataQuery, qm queryModel, service string, keyword string, raw rawTexts) backend.DataResponse {
+
+	// A transformed value isn't any sample's archived text, and after a difference the rows no longer line up
+	// with the samples, so the raw column is left null
+	if qm.Transform != TRANSFORM_NONE && raw != nil {
+		raw = rawTexts{}
+	}
+
+	// The logs format comes back as two frames, the log lines and their volume
+	if qm.Format == FORMAT_LOGS && (frame.Meta == nil || frame.Meta.Type != FRAME_TYPE_HEATMAP_CELLS) {
+		for i, field := range frame.Fields {
+			if field.Type() == data.FieldTypeTime {
+				response.Frames = append(response.Frames, logsFrames(frame, i, service, keyword, query)...)
+				return response
+			}
+		}
+	}
+
+	formatted, err := formatFrame(frame, qm.Format, service, keyword, raw)
+	if err != nil {
+		response.Error = err
+		return response
+	}
+
+	response.Frames = append(response.Frames, formatted)
+	return response
+}
@@ -0,0 +1,123 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func testFrame() *data.Frame {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	frame := data.NewFrame("response",
+		data.NewField("", nil, []float64{1.5, 2.5}),
+		data.NewField("time", nil, []time.Time{now, now.Add(time.Second)}),
+	)
+	frame.Name = "dcs.AZ"
+	return frame
+}
+
+func TestFormatTimeSeries(t *testing.T) {
+	frame, err := formatFrame(testFrame(), "", "dcs", "AZ", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Meta.Type != data.FrameTypeTimeSeriesMulti {
+		t.Errorf("unexpected frame type %s", frame.Meta.Type)
+	}
+
+	if _, err = formatFrame(testFrame(), "bogus", "dcs", "AZ", nil); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+
+	// Strings and booleans aren't time series, they go to panels as a table
+	for _, values := range []interface{}{[]string{"Open", "Closed"}, []bool{true, false}} {
+		frame = testFrame()
+		frame.Fields[0] = data.NewField("", nil, values)
+		frame, err = formatFrame(frame, FORMAT_TIME_SERIES, "dcs", "SHUTTER", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame.Meta.Type != data.FrameTypeTable {
+			t.Errorf("%s: unexpected frame type %s", frame.Fields[0].Type(), frame.Meta.Type)
+		}
+	}
+}
+
+func TestFormatWide(t *testing.T) {
+	frame, err := formatFrame(testFrame(), FORMAT_WIDE, "dcs", "AZ", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Fields[0].Name != "time" || frame.Fields[1].Name != "dcs.AZ" || frame.Meta.Type != data.FrameTypeTable {
+		t.Errorf("unexpected wide table %s, %s, %s", frame.Fields[0].Name, frame.Fields[1].Name, frame.Meta.Type)
+	}
+}
+
+func TestFormatLongTable(t *testing.T) {
+	source := testFrame()
+	raw := rawTexts{}
+	raw.add(source.Fields[1].At(0).(time.Time), "1.50")
+
+	frame, err := formatFrame(source, FORMAT_TABLE, "dcs", "AZ", raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{"time", "service", "keyword", "value", "raw value"}
+	for i, name := range names {
+		if frame.Fields[i].Name != name {
+			t.Fatalf("expected column %s, got %s", name, frame.Fields[i].Name)
+		}
+	}
+	if v, _ := frame.Fields[4].ConcreteAt(0); frame.Rows() != 2 || v != "1.50" {
+		t.Errorf("unexpected raw value %v", v)
+	}
+	if _, ok := frame.Fields[4].ConcreteAt(1); ok {
+		t.Errorf("expected a null raw value for a row without archived text")
+	}
+	if v, _ := frame.Fields[3].ConcreteAt(1); v.(float64) != 2.5 {
+		t.Errorf("unexpected value %v", v)
+	}
+
+	// Without an archive the value is formatted instead
+	frame, _ = formatFrame(testFrame(), FORMAT_TABLE, "ephem", "JD", nil)
+	if v, _ := frame.Fields[4].ConcreteAt(1); v != "2.5" {
+		t.Errorf("expected the formatted value, got %v", v)
+	}
+}
+
+func TestFormatLongTableRaw(t *testing.T) {
+	// Two samples at the same time keep their own archived text
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := data.NewFrame("response",
+		data.NewField("", nil, []float64{1, 2}),
+		data.NewField("time", nil, []time.Time{now, now}),
+	)
+	raw := rawTexts{}
+	raw.add(now, "1.0")
+	raw.add(now, "2.0")
+
+	frame, err := formatFrame(source, FORMAT_TABLE, "dcs", "AZ", raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := frame.Fields[4].ConcreteAt(0)
+	second, _ := frame.Fields[4].ConcreteAt(1)
+	if first != "1.0" || second != "2.0" {
+		t.Errorf("unexpected raw values %v, %v", first, second)
+	}
+
+	// A transformed series has no archived text of its own
+	qm := queryModel{Format: FORMAT_TABLE, Transform: TRANSFORM_DELTA}
+	response := formattedResponse(backend.DataResponse{}, testFrame(), backend.DataQuery{}, qm, "dcs", "AZ", raw)
+	if response.Error != nil {
+		t.Fatal(response.Error)
+	}
+	for row := 0; row < response.Frames[0].Rows(); row++ {
+		if v, ok := response.Frames[0].Fields[4].ConcreteAt(row); ok {
+			t.Errorf("expected a null raw value after a transform, got %v", v)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package plugin
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/lib/pq"
+)
+
+// queryInstant retrieves only the latest sample at or before the end of the range, for stat and gauge panels.
+// The sample is parsed, labelled and formatted as the query asks, just as a range is.  A keyword with no samples at
+// all gives an empty frame.
+func queryInstant(db *sql.DB, config *DatasourceSettings, query backend.DataQuery, qm queryModel, service string, keyword string, keyword_type string) backend.DataResponse {
+	response := backend.DataResponse{}
+
+	to_u := float64(query.TimeRange.To.UnixNano()) * 1e-9
+	sample_time, raw, found, err := latestSample(db, pq.QuoteIdentifier(service), keyword, to_u, true)
+	if err != nil {
+		log.DefaultLogger.Error(fl() + "instant retrieval error: " + err.Error())
+		response.Error = err
+		return response
+	}
+
+	// Enumerated values carry their labels, as in the time series
+	var enumerators map[int64]string
+	if found && isEnumType(keyword_type) {
+		enumerators, err = loadEnumerators(db, config, service, keyword)
+		if err != nil {
+			log.DefaultLogger.Warn(fl() + "enumerator retrieval error: " + err.Error())
+		}
+	}
+
+	frame, err := instantFrame(qm, keyword_type, query.TimeRange.To, sample_time, raw, found, enumerators)
+	if err != nil {
+		response.Error = err
+		return response
+	}
+
+	// The single sample goes out in the requested format like a range would, there is no archived text to add
+	// since the age column has none
+	return formattedResponse(response, frame, query, qm, service, keyword, nil)
+}
+
+// instantFrame builds the frame for a latest sample: the value, the time it was sampled and its age in seconds at
+// the end of the range, so stale values can be colored.  Without a sample the fields are empty and a notice says so.
+func instantFrame(qm queryModel, keyword_type string, to time.Time, sample_time time.Time, raw sql.NullString, found bool, enumerators map[int64]string) (*data.Frame, error) {
+	frame := data.NewFrame("response")
+	frame.RefID = qm.RefId
+	frame.Name = qm.QueryText
+
+	if !found {
+		frame.Fields = append(frame.Fields,
+			data.NewField("", nil, []*float64{}),
+			data.NewField("time", nil, []time.Time{}),
+			data.NewField("age", nil, []float64{}),
+		)
+		frame.AppendNotices(data.Notice{Severity: data.NoticeSeverityInfo, Text: fmt.Sprintf("%s has no samples before %s", qm.QueryText, to.UTC().Format(time.RFC3339))})
+		return frame, nil
+	}
+
+	var value *data.Field
+	switch {
+	case keyword_type == "KTL_STRING" && qm.Parse != PARSE_NONE:
+		// Sexagesimal strings are parsed into angles as they are for a range, an unreadable one is a null
+		if _, err := parseAngle("0", qm.Parse); err != nil {
+			return nil, err
+		}
+		var nullable *float64
+		if angle, err := parseAngle(raw.String, qm.Parse); err == nil {
+			angle, err = convertUnits(angle, qm.UnitConversion)
+			if err != nil {
+				return nil, err
+			}
+			nullable = &angle
+		}
+		value = data.NewField("", nil, []*float64{nullable})
+
+	case keyword_type == "KTL_STRING" || isArrayType(keyword_type):
+		value = data.NewField("", nil, []string{raw.String})
+
+	case isBooleanType(keyword_type):
+		b, err := parseBoolean(raw.String)
+		if err != nil {
+			value = data.NewField("", nil, []*bool{nil})
+		} else {
+			value = data.NewField("", nil, []*bool{&b})
+		}
+
+	default:
+		v, ok := parseNumber(raw)
+		var nullable *float64
+		if ok {
+			var err error
+			v, err = convertUnits(v, qm.UnitConversion)
+			if err != nil {
+				return nil, err
+			}
+			nullable = &v
+		}
+		value = data.NewField("", nil, []*float64{nullable})
+
+		// Enumerated values are either their labels or numbers with the labels as value mappings
+		if len(enumerators) > 0 && qm.EnumText {
+			label := math.NaN()
+			if nullable != nil {
+				label = *nullable
+			}
+			value = data.NewField("", nil, enumLabels([]float64{label}, enumerators))
+		} else if len(enumerators) > 0 {
+			value.Config = &data.FieldConfig{Mappings: enumMappings(enumerators)}
+		}
+	}
+
+	frame.Fields = append(frame.Fields,
+		value,
+		data.NewField("time", nil, []time.Time{sample_time}),
+		data.NewField("age", nil, []float64{to.Sub(sample_time).Seconds()}).SetConfig(&data.FieldConfig{Unit: "s"}),
+	)
+
+	return frame, nil
+}
@@ -0,0 +1,119 @@
+package plugin
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestInstantFrame(t *testing.T) {
+	to := time.Date(2024, 1, 1, 0, 1, 0, 0, time.UTC)
+	sampled := to.Add(-90 * time.Second)
+	qm := queryModel{QueryText: "dcs.EL", RefId: "A", UnitConversion: UNIT_CONVERT_DEG_TO_RAD}
+
+	frame, err := instantFrame(qm, "KTL_DOUBLE", to, sampled, sql.NullString{String: "90", Valid: true}, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Rows() != 1 || len(frame.Fields) != 3 || frame.RefID != "A" {
+		t.Fatalf("expected one row of value, time and age")
+	}
+	if v := frame.Fields[0].At(0).(*float64); v == nil || math.Abs(*v-math.Pi/2) > 1e-9 {
+		t.Errorf("expected the converted value, got %v", v)
+	}
+	if !frame.Fields[1].At(0).(time.Time).Equal(sampled) {
+		t.Errorf("unexpected sample time %v", frame.Fields[1].At(0))
+	}
+	if age := frame.Fields[2]; age.At(0).(float64) != 90 || age.Config.Unit != "s" {
+		t.Errorf("expected an age of 90s, got %v", age.At(0))
+	}
+
+	// An unreadable number is a null rather than an error
+	frame, err = instantFrame(qm, "KTL_DOUBLE", to, sampled, sql.NullString{String: "junk", Valid: true}, true, nil)
+	if err != nil || frame.Fields[0].At(0).(*float64) != nil {
+		t.Errorf("expected a null for an unreadable number")
+	}
+}
+
+func TestInstantFrameNotFound(t *testing.T) {
+	to := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	frame, err := instantFrame(queryModel{QueryText: "dcs.EL"}, "KTL_DOUBLE", to, time.Time{}, sql.NullString{}, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Rows() != 0 || len(frame.Fields) != 3 {
+		t.Errorf("expected empty value, time and age fields")
+	}
+	if frame.Meta == nil || len(frame.Meta.Notices) != 1 || frame.Meta.Notices[0].Severity != data.NoticeSeverityInfo {
+		t.Errorf("expected a notice that there are no samples")
+	}
+}
+
+func TestInstantFrameTypes(t *testing.T) {
+	to := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sampled := to.Add(-time.Second)
+	qm := queryModel{QueryText: "dome.SHUTTER"}
+
+	frame, err := instantFrame(qm, "KTL_BOOLEAN", to, sampled, sql.NullString{String: "on", Valid: true}, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := frame.Fields[0].At(0).(*bool); b == nil || !*b {
+		t.Errorf("expected true, got %v", b)
+	}
+	frame, _ = instantFrame(qm, "KTL_BOOLEAN", to, sampled, sql.NullString{String: "maybe", Valid: true}, true, nil)
+	if b := frame.Fields[0].At(0).(*bool); b != nil {
+		t.Errorf("expected a null for an unreadable boolean, got %v", *b)
+	}
+
+	// Enumerated values stay numbers with their labels as value mappings
+	frame, _ = instantFrame(qm, "KTL_ENUM", to, sampled, sql.NullString{String: "1", Valid: true}, true, map[int64]string{0: "Closed", 1: "Open"})
+	if v := frame.Fields[0].At(0).(*float64); v == nil || *v != 1 {
+		t.Errorf("expected the enumerated value 1, got %v", v)
+	}
+	if config := frame.Fields[0].Config; config == nil || len(config.Mappings) != 1 {
+		t.Fatalf("expected value mappings for the enumerators")
+	}
+	if mapper := frame.Fields[0].Config.Mappings[0].(data.ValueMapper); mapper["1"].Text != "Open" {
+		t.Errorf("unexpected mapping %v", mapper)
+	}
+
+	frame, _ = instantFrame(qm, "KTL_STRING", to, sampled, sql.NullString{String: "Open", Valid: true}, true, nil)
+	if s := frame.Fields[0].At(0).(string); s != "Open" {
+		t.Errorf("expected the string as is, got %q", s)
+	}
+}
+
+func TestInstantFrameOptions(t *testing.T) {
+	to := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sampled := to.Add(-time.Second)
+
+	// Sexagesimal strings are parsed into angles as a range would be
+	qm := queryModel{QueryText: "dcs.RA", Parse: PARSE_SEXAGESIMAL_HOURS_TO_DEG}
+	frame, err := instantFrame(qm, "KTL_STRING", to, sampled, sql.NullString{String: "06:30:00", Valid: true}, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := frame.Fields[0].At(0).(*float64); v == nil || *v != 97.5 {
+		t.Errorf("expected 97.5 degrees, got %v", v)
+	}
+	frame, _ = instantFrame(qm, "KTL_STRING", to, sampled, sql.NullString{String: "junk", Valid: true}, true, nil)
+	if v := frame.Fields[0].At(0).(*float64); v != nil {
+		t.Errorf("expected a null for an unparseable angle, got %v", *v)
+	}
+	qm.Parse = 99
+	if _, err = instantFrame(qm, "KTL_STRING", to, sampled, sql.NullString{String: "06:30:00", Valid: true}, true, nil); err == nil {
+		t.Error("expected an error for an unknown parse mode")
+	}
+
+	// With enum text the label takes the place of the number
+	qm = queryModel{QueryText: "dome.SHUTTER", EnumText: true}
+	frame, _ = instantFrame(qm, "KTL_ENUM", to, sampled, sql.NullString{String: "1", Valid: true}, true, map[int64]string{0: "Closed", 1: "Open"})
+	if v := frame.Fields[0].At(0).(*string); v == nil || *v != "Open" {
+		t.Errorf("expected the label Open, got %v", v)
+	}
+}
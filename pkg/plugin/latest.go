@@ -0,0 +1,57 @@
+package plugin
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+// unixToTime converts an archive time, Unix seconds as a floating point, into a time.Time
+func unixToTime(t float64) time.Time {
+	// Separate the fractional seconds so we can convert it into a time.Time
+	sec, dec := math.Modf(t)
+	return time.Unix(int64(sec), int64(dec*(1e9)))
+}
+
+// latestSample retrieves the most recent sample of a keyword before (or, inclusive, at) the given Unix time.  The
+// table must already be quoted.  The time index makes this a single index probe however long the history is.
+func latestSample(db *sql.DB, table string, keyword string, at float64, inclusive bool) (time.Time, sql.NullString, bool, error) {
+	comparison := "<"
+	if inclusive {
+		comparison = "<="
+	}
+
+	sql_latest := fmt.Sprintf("select time, trim(binvalue) from %s where keyword = $1 and time %s $2 order by time desc limit 1;", table, comparison)
+	row := db.QueryRow(sql_latest, keyword, at)
+
+	var timetemp float64
+	var value sql.NullString
+	switch err := row.Scan(&timetemp, &value); err {
+	case sql.ErrNoRows:
+		return time.Time{}, value, false, nil
+	case nil:
+		return unixToTime(timetemp), value, true, nil
+	default:
+		return time.Time{}, value, false, err
+	}
+}
+
+// prependPrior puts the value of a prior sample at the front of the series, timestamped at the given time (the start
+// of the range), so the first change inside the range has something to be a change from.  A prior value that can't
+// be read as a number, or converted, is left out.
+func prependPrior(times []time.Time, values_strings []string, values_floats []float64, scan_string bool, at time.Time, prior sql.NullString, conversion int) ([]time.Time, []string, []float64) {
+	if scan_string {
+		return append([]time.Time{at}, times...), append([]string{prior.String}, values_strings...), values_floats
+	}
+
+	v, ok := parseNumber(prior)
+	if !ok {
+		return times, values_strings, values_floats
+	}
+	v, err := convertUnits(v, conversion)
+	if err != nil {
+		return times, values_strings, values_floats
+	}
+	return append([]time.Time{at}, times...), values_strings, append([]float64{v}, values_floats...)
+}
@@ -0,0 +1,109 @@
+package plugin
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// The logs format shows each sample as a log line, it's intended for *MSG and error keywords
+const FORMAT_LOGS = "logs"
+
+// logsFrames turns a keyword frame into a log lines frame, with a body per sample and the service and keyword as
+// labels, plus a time series of sample counts per interval for the histogram above the logs in Explore
+func logsFrames(frame *data.Frame, timeIndex int, service string, keyword string, query backend.DataQuery) []*data.Frame {
+	timeField := frame.Fields[timeIndex]
+
+	labels, _ := json.Marshal(map[string]string{"service": service, "keyword": keyword})
+
+	timestamps := make([]time.Time, timeField.Len())
+	bodies := make([]string, timeField.Len())
+	labelValues := make([]json.RawMessage, timeField.Len())
+
+	for row := 0; row < timeField.Len(); row++ {
+		timestamps[row] = timeField.At(row).(time.Time)
+		labelValues[row] = labels
+
+		// A single value is the whole body, several (bits or elements) are given as name=value pairs
+		parts := []string{}
+		for i, field := range frame.Fields {
+			if i == timeIndex {
+				continue
+			}
+			text := fieldText(field, row)
+			if len(frame.Fields) > 2 {
+				text = field.Name + "=" + text
+			}
+			parts = append(parts, text)
+		}
+		bodies[row] = strings.Join(parts, " ")
+	}
+
+	logs := data.NewFrame(frame.Name,
+		data.NewField("timestamp", nil, timestamps),
+		data.NewField("body", nil, bodies),
+		data.NewField("labels", nil, labelValues),
+	)
+	logs.RefID = frame.RefID
+	logs.Meta = frame.Meta
+	setFrameType(logs, data.FrameTypeLogLines)
+	logs.Meta.PreferredVisualization = data.VisTypeLogs
+
+	volume := logsVolume(timestamps, query)
+	volume.RefID = frame.RefID
+	volume.Name = frame.Name
+
+	return []*data.Frame{logs, volume}
+}
+
+// logsVolume counts samples in buckets of the query interval across the whole range, empty buckets included
+func logsVolume(timestamps []time.Time, query backend.DataQuery) *data.Frame {
+	step := queryStep(query, QUERY_MAX_POINTS)
+	from := query.TimeRange.From.Truncate(step)
+
+	buckets := int(query.TimeRange.To.Sub(from)/step) + 1
+	times := make([]time.Time, buckets)
+	counts := make([]float64, buckets)
+	for i := range times {
+		times[i] = from.Add(time.Duration(i) * step)
+	}
+
+	for _, t := range timestamps {
+		i := int(t.Sub(from) / step)
+		if i >= 0 && i < buckets {
+			counts[i]++
+		}
+	}
+
+	volume := data.NewFrame("",
+		data.NewField("time", nil, times),
+		data.NewField("count", nil, counts),
+	)
+	setFrameType(volume, data.FrameTypeTimeSeriesMulti)
+	volume.Meta.PreferredVisualization = data.VisTypeGraph
+
+	return volume
+}
+
+// fieldText formats one value of a field for a log body, null is left empty
+func fieldText(field *data.Field, row int) string {
+	value, ok := field.ConcreteAt(row)
+	if !ok {
+		return ""
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return ""
+	}
+}
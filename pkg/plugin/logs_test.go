@@ -0,0 +1,44 @@
+package plugin
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+func TestLogsFrames(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	frame := data.NewFrame("response",
+		data.NewField("", nil, []string{"starting", "ready", "fault"}),
+		data.NewField("time", nil, []time.Time{from.Add(time.Second), from.Add(2 * time.Second), from.Add(90 * time.Second)}),
+	)
+	query := backend.DataQuery{
+		TimeRange: backend.TimeRange{From: from, To: from.Add(3 * time.Minute)},
+		Interval:  time.Minute,
+	}
+
+	frames := logsFrames(frame, 1, "ao", "MSG", query)
+	if len(frames) != 2 {
+		t.Fatalf("expected logs and volume frames, got %d", len(frames))
+	}
+
+	logs := frames[0]
+	if logs.Meta.Type != data.FrameTypeLogLines || logs.Meta.PreferredVisualization != data.VisTypeLogs {
+		t.Errorf("unexpected logs metadata %v", logs.Meta)
+	}
+	if logs.Fields[1].At(2) != "fault" {
+		t.Errorf("unexpected body %v", logs.Fields[1].At(2))
+	}
+	labels := map[string]string{}
+	if err := json.Unmarshal(logs.Fields[2].At(0).(json.RawMessage), &labels); err != nil || labels["keyword"] != "MSG" {
+		t.Errorf("unexpected labels %v", labels)
+	}
+
+	volume := frames[1]
+	if volume.Rows() != 4 || volume.Fields[1].At(0) != 2.0 || volume.Fields[1].At(1) != 1.0 || volume.Fields[1].At(2) != 0.0 {
+		t.Errorf("unexpected volume counts")
+	}
+}
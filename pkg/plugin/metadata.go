@@ -0,0 +1,231 @@
+package plugin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Meta table columns that may hold each piece of metadata, tried in order.  Archives differ in what they record
+// so none of these need exist, a missing column just leaves the field empty.
+var (
+	META_UNITS_COLUMNS       = []string{"units", "unit"}
+	META_DESCRIPTION_COLUMNS = []string{"description", "help", "comment"}
+	META_MIN_COLUMNS         = []string{"min", "minimum", "lower", "low"}
+	META_MAX_COLUMNS         = []string{"max", "maximum", "upper", "high"}
+)
+
+// enumerator is one value and label of an enumerated keyword
+type enumerator struct {
+	Value int64  `json:"value"`
+	Label string `json:"label"`
+}
+
+// keywordLimits is the range a keyword's value is declared to lie within, either end may be open
+type keywordLimits struct {
+	Min *float64 `json:"min"`
+	Max *float64 `json:"max"`
+}
+
+// keywordMetadata is everything known about one keyword, as returned by the /keyword resource
+type keywordMetadata struct {
+	Service     string        `json:"service"`
+	Keyword     string        `json:"keyword"`
+	Type        string        `json:"type"`
+	Units       string        `json:"units"`
+	Description string        `json:"description"`
+	Enumerators []enumerator  `json:"enumerators"`
+	Limits      keywordLimits `json:"limits"`
+	First       *time.Time    `json:"first"`
+	Last        *time.Time    `json:"last"`
+	Count       int64         `json:"count"`
+	Computed    bool          `json:"computed"`
+}
+
+// metaString returns the first of the named columns present in a meta table row as text
+func metaString(row map[string]interface{}, names []string) string {
+	for _, name := range names {
+		switch v := row[name].(type) {
+		case string:
+			return strings.TrimSpace(v)
+		case float64:
+			return strconv.FormatFloat(v, 'g', -1, 64)
+		}
+	}
+	return ""
+}
+
+// metaNumber returns the first of the named columns present in a meta table row as a number, nil if there is none
+func metaNumber(row map[string]interface{}, names []string) *float64 {
+	for _, name := range names {
+		switch v := row[name].(type) {
+		case float64:
+			return &v
+		case string:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil && !math.IsNaN(f) {
+				return &f
+			}
+		}
+	}
+	return nil
+}
+
+// enumeratorList orders enumerators by value
+func enumeratorList(enumerators map[int64]string) []enumerator {
+	list := make([]enumerator, 0, len(enumerators))
+	for value, label := range enumerators {
+		list = append(list, enumerator{Value: value, Label: label})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Value < list[j].Value })
+	return list
+}
+
+// planRows reads the planner's row estimate from the output of explain (format json)
+func planRows(plan []byte) (int64, error) {
+	var explained []struct {
+		Plan struct {
+			Rows float64 `json:"Plan Rows"`
+		} `json:"Plan"`
+	}
+	err := json.Unmarshal(plan, &explained)
+	if err != nil {
+		return 0, err
+	}
+	if len(explained) == 0 {
+		return 0, fmt.Errorf("empty query plan")
+	}
+	return int64(explained[0].Plan.Rows), nil
+}
+
+// approximateCount estimates how many samples a keyword has from the planner statistics, counting them exactly
+// would mean reading every one of them
+func approximateCount(db *sql.DB, quotedTable string, keyword string) (int64, error) {
+	sql_explain := fmt.Sprintf("explain (format json) select 1 from %s where keyword = %s;", quotedTable, pq.QuoteLiteral(keyword))
+
+	var plan []byte
+	err := db.QueryRow(sql_explain).Scan(&plan)
+	if err != nil {
+		return 0, err
+	}
+	return planRows(plan)
+}
+
+// loadKeywordMetadata gathers the meta table entry, enumerators and sample range of a keyword.  It returns nil
+// for a keyword that isn't in the meta table.
+func loadKeywordMetadata(db *sql.DB, config *DatasourceSettings, service string, keyword string) (*keywordMetadata, error) {
+
+	// The computed ephem service has no meta table entries or archive
+	if service == EPHEM_SERVICE {
+		description, ok := ephemKeywords[keyword]
+		if !ok {
+			return nil, nil
+		}
+		return &keywordMetadata{Service: service, Keyword: keyword, Type: "KTL_DOUBLE", Description: description, Enumerators: []enumerator{}, Computed: true}, nil
+	}
+
+	// Read the whole row as JSON so the columns an archive doesn't have are simply absent
+	sql_meta := fmt.Sprintf("select to_jsonb(m) from %s m where m.service = $1 and m.keyword = $2 limit 1;", config.metaTable())
+	var entry []byte
+	switch err := db.QueryRow(sql_meta, service, keyword).Scan(&entry); err {
+	case sql.ErrNoRows:
+		return nil, nil
+	case nil:
+	default:
+		return nil, err
+	}
+
+	row := map[string]interface{}{}
+	err := json.Unmarshal(entry, &row)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := &keywordMetadata{
+		Service:     service,
+		Keyword:     keyword,
+		Type:        metaString(row, []string{"type"}),
+		Units:       metaString(row, META_UNITS_COLUMNS),
+		Description: metaString(row, META_DESCRIPTION_COLUMNS),
+		Enumerators: []enumerator{},
+		Limits:      keywordLimits{Min: metaNumber(row, META_MIN_COLUMNS), Max: metaNumber(row, META_MAX_COLUMNS)},
+	}
+
+	// Without an enum table the enumerators are in the row already read, if the archive records them at all
+	if isEnumType(metadata.Type) || metadata.Type == "KTL_MASK" {
+		var enumerators map[int64]string
+		if config.EnumTable != "" {
+			enumerators, err = loadEnumerators(db, config, service, keyword)
+		} else {
+			enumerators, err = metaEnumerators(row)
+		}
+		if err != nil {
+			return nil, err
+		}
+		metadata.Enumerators = enumeratorList(enumerators)
+	}
+
+	// The first and last samples come straight off the time index
+	table := pq.QuoteIdentifier(service)
+	sql_range := fmt.Sprintf("select min(time), max(time) from %s where keyword = $1;", table)
+	var first, last sql.NullFloat64
+	err = db.QueryRow(sql_range, keyword).Scan(&first, &last)
+	if err != nil {
+		return nil, err
+	}
+	if first.Valid && last.Valid {
+		first_time, last_time := unixToTime(first.Float64), unixToTime(last.Float64)
+		metadata.First, metadata.Last = &first_time, &last_time
+
+		metadata.Count, err = approximateCount(db, table, keyword)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return metadata, nil
+}
+
+// handleResourceKeyword answers /keyword?service=S&keyword=K, or /keyword?keyword=S.K, with the keyword's metadata
+func (ds *KeywordDatasource) handleResourceKeyword(rw http.ResponseWriter, req *http.Request) {
+	params, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		writeError(rw, badRequest(err))
+		return
+	}
+	service, keyword := params.Get("service"), params.Get("keyword")
+	if service == "" {
+		service, keyword, _ = strings.Cut(keyword, ".")
+	}
+	if service == "" || keyword == "" {
+		writeError(rw, badRequest(fmt.Errorf("expected service and keyword parameters")))
+		return
+	}
+
+	cfg, db, err := openResourceDatabase(req)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	defer db.Close()
+
+	metadata, err := loadKeywordMetadata(db, cfg, service, keyword)
+	if err != nil {
+		writeError(rw, tableError(err, service))
+		return
+	}
+	if metadata == nil {
+		writeError(rw, notFound(fmt.Errorf("unknown keyword: %s.%s", service, keyword)))
+		return
+	}
+
+	writeResult(rw, metadata)
+}
@@ -0,0 +1,75 @@
+package plugin
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestMetaColumns(t *testing.T) {
+	row := map[string]interface{}{}
+	err := json.Unmarshal([]byte(`{"type": "KTL_DOUBLE", "units": " deg ", "help": "Azimuth", "lower": -270, "upper": "270.5"}`), &row)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if units := metaString(row, META_UNITS_COLUMNS); units != "deg" {
+		t.Errorf("unexpected units %q", units)
+	}
+	if description := metaString(row, META_DESCRIPTION_COLUMNS); description != "Azimuth" {
+		t.Errorf("unexpected description %q", description)
+	}
+	if low := metaNumber(row, META_MIN_COLUMNS); low == nil || *low != -270 {
+		t.Errorf("unexpected lower limit %v", low)
+	}
+	if high := metaNumber(row, META_MAX_COLUMNS); high == nil || *high != 270.5 {
+		t.Errorf("unexpected upper limit %v", high)
+	}
+	if missing := metaNumber(row, []string{"nothing"}); missing != nil {
+		t.Error("expected no value for a missing column")
+	}
+}
+
+func TestEnumeratorList(t *testing.T) {
+	list := enumeratorList(map[int64]string{2: "Closed", 0: "Open", 1: "Moving"})
+	expected := []string{"Open", "Moving", "Closed"}
+
+	for i, label := range expected {
+		if list[i].Value != int64(i) || list[i].Label != label {
+			t.Errorf("unexpected enumerator %d: %v", i, list[i])
+		}
+	}
+}
+
+func TestMetaEnumerators(t *testing.T) {
+	// An archive whose meta table has no enumerators column still gives metadata for its enumerated keywords
+	row := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(`{"type": "KTL_ENUM", "units": ""}`), &row); err != nil {
+		t.Fatal(err)
+	}
+	enumerators, err := metaEnumerators(row)
+	if err != nil || len(enumerators) != 0 {
+		t.Errorf("expected no enumerators without the column, got %v %v", enumerators, err)
+	}
+
+	row["enumerators"] = "Open, Closed"
+	enumerators, err = metaEnumerators(row)
+	if err != nil || enumerators[1] != "Closed" {
+		t.Errorf("unexpected enumerators %v %v", enumerators, err)
+	}
+
+	if !isUndefinedColumn(&pq.Error{Code: "42703"}) || isUndefinedColumn(&pq.Error{Code: "42P01"}) {
+		t.Error("expected only undefined_column to match")
+	}
+}
+
+func TestPlanRows(t *testing.T) {
+	rows, err := planRows([]byte(`[{"Plan": {"Node Type": "Index Only Scan", "Plan Rows": 123456, "Plan Width": 4}}]`))
+	if err != nil || rows != 123456 {
+		t.Errorf("unexpected estimate %d (%v)", rows, err)
+	}
+	if _, err := planRows([]byte(`[]`)); err == nil {
+		t.Error("expected an error for an empty plan")
+	}
+}
@@ -0,0 +1,133 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/lib/pq"
+)
+
+// resourceError is an error with the HTTP status it should be answered with
+type resourceError struct {
+	status int
+	err    error
+}
+
+func (e *resourceError) Error() string {
+	return e.err.Error()
+}
+
+func (e *resourceError) Unwrap() error {
+	return e.err
+}
+
+// badRequest marks an error as the caller's fault, a missing or invalid parameter
+func badRequest(err error) error {
+	return &resourceError{status: http.StatusBadRequest, err: err}
+}
+
+// notFound marks an error as naming something that doesn't exist, a keyword say
+func notFound(err error) error {
+	return &resourceError{status: http.StatusNotFound, err: err}
+}
+
+// isUndefinedTable reports whether a query failed because the service table it named doesn't exist
+func isUndefinedTable(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "42P01"
+}
+
+// isUndefinedColumn reports whether a query failed because a column it named doesn't exist in this archive
+func isUndefinedColumn(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "42703"
+}
+
+// tableError marks a query on a service table that doesn't exist as not found, other errors are left alone
+func tableError(err error, service string) error {
+	if isUndefinedTable(err) {
+		return notFound(fmt.Errorf("unknown service: %s", service))
+	}
+	return err
+}
+
+// errorStatus is the HTTP status for an error, anything not marked otherwise is a server error
+func errorStatus(err error) int {
+	var re *resourceError
+	if errors.As(err, &re) {
+		return re.status
+	}
+	return http.StatusInternalServerError
+}
+
+// resourceOption is one entry of an ordered list of choices for the query editor
+type resourceOption struct {
+	Value string `json:"value"`
+	Label string `json:"label"`
+}
+
+// resourceFailure is the error part of the envelope
+type resourceFailure struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+// resourceEnvelope wraps every resource response, data is set on success and error on failure, the other is null
+type resourceEnvelope struct {
+	Data  interface{}      `json:"data"`
+	Error *resourceFailure `json:"error"`
+}
+
+// writeJSON sends an envelope with its status, headers first and then the body
+func writeJSON(rw http.ResponseWriter, status int, envelope resourceEnvelope) {
+	body, err := json.Marshal(envelope)
+	if err != nil {
+		log.DefaultLogger.Error(fl() + "resource encoding error: " + err.Error())
+		status = http.StatusInternalServerError
+		body, _ = json.Marshal(resourceEnvelope{Error: &resourceFailure{Status: status, Message: err.Error()}})
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	if _, err = rw.Write(body); err != nil {
+		log.DefaultLogger.Error(fl() + "resource write error: " + err.Error())
+	}
+}
+
+// writeResult answers a resource call with its result
+func writeResult(rw http.ResponseWriter, val interface{}) {
+	writeJSON(rw, http.StatusOK, resourceEnvelope{Data: val})
+}
+
+// writeError answers a resource call with an error, the status comes from the error.  Handlers return straight
+// after so only one response is ever written.
+func writeError(rw http.ResponseWriter, err error) {
+	status := errorStatus(err)
+	if status >= http.StatusInternalServerError {
+		log.DefaultLogger.Error(fl() + "resource error: " + err.Error())
+	}
+	writeJSON(rw, status, resourceEnvelope{Error: &resourceFailure{Status: status, Message: err.Error()}})
+}
+
+// getOnly wraps a resource handler so that anything but a GET is refused with 405
+func getOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, req *http.Request) {
+		log.DefaultLogger.Debug(fl() + "resource call url=" + req.URL.String() + "  method=" + req.Method)
+
+		if req.Method != http.MethodGet {
+			rw.Header().Set("Allow", http.MethodGet)
+			writeError(rw, &resourceError{status: http.StatusMethodNotAllowed, err: errors.New("method not allowed: " + req.Method)})
+			return
+		}
+		handler(rw, req)
+	}
+}
+
+// handleResourceNotFound answers any path without a resource of its own, in the same envelope as the rest
+func handleResourceNotFound(rw http.ResponseWriter, req *http.Request) {
+	log.DefaultLogger.Debug(fl() + "resource call url=" + req.URL.String() + "  method=" + req.Method)
+	writeError(rw, notFound(errors.New("no such resource: "+req.URL.Path)))
+}
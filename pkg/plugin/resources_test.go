@@ -0,0 +1,128 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func decodeEnvelope(t *testing.T, rec *httptest.ResponseRecorder) map[string]json.RawMessage {
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+	envelope := map[string]json.RawMessage{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("bad envelope %q: %v", rec.Body.String(), err)
+	}
+	return envelope
+}
+
+func TestWriteError(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+	}{
+		{badRequest(errors.New("bad")), http.StatusBadRequest},
+		{notFound(errors.New("missing")), http.StatusNotFound},
+		{errors.New("broken"), http.StatusInternalServerError},
+	}
+
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		writeError(rec, c.err)
+
+		if rec.Code != c.status {
+			t.Errorf("%v: expected status %d, got %d", c.err, c.status, rec.Code)
+		}
+		envelope := decodeEnvelope(t, rec)
+		var failure resourceFailure
+		if err := json.Unmarshal(envelope["error"], &failure); err != nil || failure.Status != c.status || failure.Message != c.err.Error() {
+			t.Errorf("%v: unexpected error %s", c.err, envelope["error"])
+		}
+		if string(envelope["data"]) != "null" {
+			t.Errorf("%v: expected null data, got %s", c.err, envelope["data"])
+		}
+	}
+}
+
+func TestWriteResult(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeResult(rec, []resourceOption{})
+
+	envelope := decodeEnvelope(t, rec)
+	if rec.Code != http.StatusOK || string(envelope["data"]) != "[]" || string(envelope["error"]) != "null" {
+		t.Errorf("unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestGetOnly(t *testing.T) {
+	called := false
+	handler := getOnly(func(rw http.ResponseWriter, req *http.Request) {
+		called = true
+		writeResult(rw, "ok")
+	})
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/services", nil))
+	if called || rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != http.MethodGet {
+		t.Errorf("expected a POST refused, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, "/services", nil))
+	if !called || rec.Code != http.StatusOK {
+		t.Errorf("expected a GET answered, got %d", rec.Code)
+	}
+}
+
+func TestHandleResourceKeywords(t *testing.T) {
+	ds := &KeywordDatasource{}
+
+	rec := httptest.NewRecorder()
+	ds.handleResourceKeywords(rec, httptest.NewRequest(http.MethodGet, "/keywords", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a service, got %d", rec.Code)
+	}
+
+	// The ephem keywords come back in name order without touching the database
+	rec = httptest.NewRecorder()
+	ds.handleResourceKeywords(rec, httptest.NewRequest(http.MethodGet, "/keywords?service=ephem", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", rec.Code)
+	}
+
+	var keywords []resourceOption
+	if err := json.Unmarshal(decodeEnvelope(t, rec)["data"], &keywords); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"JD", "LST", "MOONALT", "MOONILLUM", "SUNALT"}
+	if len(keywords) != len(expected) {
+		t.Fatalf("expected %d keywords, got %v", len(expected), keywords)
+	}
+	for i, keyword := range expected {
+		if keywords[i].Value != keyword || keywords[i].Label != "ephem."+keyword {
+			t.Errorf("unexpected keyword %d: %v", i, keywords[i])
+		}
+	}
+}
+
+func TestResourceMux(t *testing.T) {
+	mux := (&KeywordDatasource{}).resourceMux()
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/nothing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown path, got %d", rec.Code)
+	}
+	if envelope := decodeEnvelope(t, rec); string(envelope["error"]) == "null" {
+		t.Errorf("expected an error in the envelope, got %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/keywords?service=ephem", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected 200 for a known path, got %d", rec.Code)
+	}
+}
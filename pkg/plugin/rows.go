@@ -0,0 +1,75 @@
+package plugin
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// parseNumber reads an archived value as a number.  Nulls, empty strings, NaN, infinities and anything with
+// trailing text (a stray unit suffix, say) are all unreadable.
+func parseNumber(raw sql.NullString) (float64, bool) {
+	if !raw.Valid {
+		return 0, false
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(raw.String), 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, false
+	}
+
+	return value, true
+}
+
+// rawValue gives the text of an archived value for quoting in a notice
+func rawValue(raw sql.NullString) string {
+	if !raw.Valid {
+		return "NULL"
+	}
+	return raw.String
+}
+
+// checkBadRows fails a query once the fraction of unreadable rows goes over the limit.  An unset limit means the
+// default, a limit of zero fails on any unreadable row, and a limit of one never fails.
+func checkBadRows(bad int, total int, maxRatio *float64) error {
+	limit := BAD_ROWS_DEFAULT_MAX_RATIO
+	if maxRatio != nil {
+		limit = *maxRatio
+	}
+	if total == 0 {
+		return nil
+	}
+
+	ratio := float64(bad) / float64(total)
+	if ratio > limit {
+		return fmt.Errorf("%d of %d values could not be read (%.0f%%, limit %.0f%%)", bad, total, ratio*100, limit*100)
+	}
+
+	return nil
+}
+
+// floatField builds a numeric field, switching to a nullable one if any value is NaN (an unreadable row)
+func floatField(name string, values []float64) *data.Field {
+	nulls := false
+	for _, value := range values {
+		if math.IsNaN(value) {
+			nulls = true
+			break
+		}
+	}
+	if !nulls {
+		return data.NewField(name, nil, values)
+	}
+
+	nullable := make([]*float64, len(values))
+	for i := range values {
+		if !math.IsNaN(values[i]) {
+			nullable[i] = &values[i]
+		}
+	}
+	return data.NewField(name, nil, nullable)
+}
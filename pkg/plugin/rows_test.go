@@ -0,0 +1,59 @@
+package plugin
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+)
+
+func TestParseNumber(t *testing.T) {
+	if value, ok := parseNumber(sql.NullString{String: " 12.5 ", Valid: true}); !ok || value != 12.5 {
+		t.Errorf("expected 12.5, got %f", value)
+	}
+
+	for _, raw := range []sql.NullString{{}, {String: "", Valid: true}, {String: "nan", Valid: true}, {String: "12.5 mm", Valid: true}, {String: "inf", Valid: true}} {
+		if _, ok := parseNumber(raw); ok {
+			t.Errorf("%q: expected an unreadable value", rawValue(raw))
+		}
+	}
+}
+
+func TestCheckBadRows(t *testing.T) {
+	limit := func(ratio float64) *float64 { return &ratio }
+
+	if err := checkBadRows(5, 10, nil); err != nil {
+		t.Errorf("half bad should pass the default limit: %s", err)
+	}
+	if err := checkBadRows(6, 10, nil); err == nil {
+		t.Error("more than half bad should fail the default limit")
+	}
+	if err := checkBadRows(10, 10, limit(1)); err != nil {
+		t.Errorf("a limit of one should never fail: %s", err)
+	}
+	if err := checkBadRows(1, 10, limit(0.05)); err == nil {
+		t.Error("10% bad should fail a 5% limit")
+	}
+	if err := checkBadRows(1, 10, limit(0)); err == nil {
+		t.Error("any bad row should fail a limit of zero")
+	}
+	if err := checkBadRows(0, 10, limit(0)); err != nil {
+		t.Errorf("no bad rows should pass a limit of zero: %s", err)
+	}
+}
+
+func TestFloatField(t *testing.T) {
+	if field := floatField("", []float64{1, 2}); field.Type().Nullable() {
+		t.Error("expected a plain field without NaNs")
+	}
+
+	field := floatField("", []float64{1, math.NaN(), 3})
+	if !field.Type().Nullable() {
+		t.Fatal("expected a nullable field with NaNs")
+	}
+	if _, ok := field.ConcreteAt(1); ok {
+		t.Error("expected the NaN to be null")
+	}
+	if v, _ := field.ConcreteAt(2); v.(float64) != 3 {
+		t.Errorf("expected 3, got %v", v)
+	}
+}
@@ -0,0 +1,266 @@
+package plugin
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Define the ways a search matches its text against keywords
+const (
+	SEARCH_MODE_SUBSTRING = "substring"
+	SEARCH_MODE_PREFIX    = "prefix"
+	SEARCH_MODE_FUZZY     = "fuzzy"
+)
+
+// Page sizes of the search results
+const (
+	SEARCH_DEFAULT_LIMIT = 50
+	SEARCH_MAX_LIMIT     = 500
+)
+
+// Scores of the different kinds of match, an exact keyword name ranks above a prefix, above a substring and so on
+const (
+	SEARCH_SCORE_EXACT       = 100.0
+	SEARCH_SCORE_PREFIX      = 80.0
+	SEARCH_SCORE_SUBSTRING   = 60.0
+	SEARCH_SCORE_FULL_NAME   = 50.0
+	SEARCH_SCORE_FUZZY       = 40.0
+	SEARCH_SCORE_DESCRIPTION = 20.0
+)
+
+// searchEntry is one service/keyword pair that can be searched for
+type searchEntry struct {
+	Service     string `json:"service"`
+	Keyword     string `json:"keyword"`
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+// searchResult is an entry that matched, with how well it matched
+type searchResult struct {
+	searchEntry
+	Score float64 `json:"score"`
+}
+
+// searchPage is one page of ranked results along with the total so callers can page through them
+type searchPage struct {
+	Results []searchResult `json:"results"`
+	Total   int            `json:"total"`
+	Offset  int            `json:"offset"`
+	Limit   int            `json:"limit"`
+}
+
+// loadSearchEntries reads every service/keyword pair from the meta table, with its description where the archive
+// records one, plus the computed ephem keywords
+func loadSearchEntries(db *sql.DB, config *DatasourceSettings) ([]searchEntry, error) {
+	sql_entries := fmt.Sprintf("select m.service, m.keyword, m.type, to_jsonb(m) from %s m order by m.service, m.keyword;", config.metaTable())
+	rows, err := db.Query(sql_entries)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []searchEntry{}
+	for rows.Next() {
+		var entry searchEntry
+		var keyword_type sql.NullString
+		var meta []byte
+		err = rows.Scan(&entry.Service, &entry.Keyword, &keyword_type, &meta)
+		if err != nil {
+			return nil, err
+		}
+		entry.Type = keyword_type.String
+
+		row := map[string]interface{}{}
+		if json.Unmarshal(meta, &row) == nil {
+			entry.Description = metaString(row, META_DESCRIPTION_COLUMNS)
+		}
+
+		entries = append(entries, entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for keyword, description := range ephemKeywords {
+		entries = append(entries, searchEntry{Service: EPHEM_SERVICE, Keyword: keyword, Type: "KTL_DOUBLE", Description: description})
+	}
+
+	return entries, nil
+}
+
+// fuzzyScore matches a pattern as a subsequence of a candidate, both already lower case, scoring how tightly the
+// characters sit together: 1 when they are contiguous, towards 0 as they spread out
+func fuzzyScore(pattern string, candidate string) (float64, bool) {
+	if pattern == "" {
+		return 0, false
+	}
+
+	p := []rune(pattern)
+	matched, start, end := 0, -1, -1
+	for i, r := range []rune(candidate) {
+		if r != p[matched] {
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+		matched++
+		if matched == len(p) {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return 0, false
+	}
+
+	return float64(len(p)) / float64(end-start+1), true
+}
+
+// scoreEntry scores one entry against lower case search text, zero if it doesn't match at all
+func scoreEntry(entry searchEntry, text string, mode string) float64 {
+	keyword := strings.ToLower(entry.Keyword)
+	full := strings.ToLower(entry.Service + "." + entry.Keyword)
+
+	switch {
+	case keyword == text || full == text:
+		return SEARCH_SCORE_EXACT
+	case strings.HasPrefix(keyword, text):
+		return SEARCH_SCORE_PREFIX
+	case strings.HasPrefix(full, text):
+		return SEARCH_SCORE_FULL_NAME
+	case mode == SEARCH_MODE_PREFIX:
+		return 0
+	case strings.Contains(keyword, text):
+		return SEARCH_SCORE_SUBSTRING
+	case strings.Contains(full, text):
+		return SEARCH_SCORE_FULL_NAME
+	}
+
+	if mode == SEARCH_MODE_FUZZY {
+		if score, ok := fuzzyScore(text, full); ok {
+			return SEARCH_SCORE_FUZZY * score
+		}
+	}
+
+	if strings.Contains(strings.ToLower(entry.Description), text) {
+		return SEARCH_SCORE_DESCRIPTION
+	}
+
+	return 0
+}
+
+// searchKeywords ranks the entries matching the text by score, then by service and keyword
+func searchKeywords(entries []searchEntry, text string, mode string) ([]searchResult, error) {
+	switch mode {
+	case "":
+		mode = SEARCH_MODE_SUBSTRING
+	case SEARCH_MODE_SUBSTRING, SEARCH_MODE_PREFIX, SEARCH_MODE_FUZZY:
+	default:
+		return nil, fmt.Errorf("unknown search mode: %q, expected substring, prefix or fuzzy", mode)
+	}
+
+	text = strings.ToLower(strings.TrimSpace(text))
+	if text == "" {
+		return nil, fmt.Errorf("empty search text")
+	}
+
+	results := []searchResult{}
+	for _, entry := range entries {
+		if score := scoreEntry(entry, text, mode); score > 0 {
+			results = append(results, searchResult{searchEntry: entry, Score: score})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		switch {
+		case a.Score != b.Score:
+			return a.Score > b.Score
+		case a.Service != b.Service:
+			return a.Service < b.Service
+		default:
+			return a.Keyword < b.Keyword
+		}
+	})
+
+	return results, nil
+}
+
+// paginate cuts one page out of the ranked results, a zero limit picks the default page size
+func paginate(results []searchResult, offset int, limit int) searchPage {
+	if limit <= 0 {
+		limit = SEARCH_DEFAULT_LIMIT
+	}
+	if limit > SEARCH_MAX_LIMIT {
+		limit = SEARCH_MAX_LIMIT
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	page := searchPage{Results: []searchResult{}, Total: len(results), Offset: offset, Limit: limit}
+	if offset < len(results) {
+		end := offset + limit
+		if end > len(results) {
+			end = len(results)
+		}
+		page.Results = results[offset:end]
+	}
+
+	return page
+}
+
+// handleResourceSearch answers /search?q=TEMP&mode=substring|prefix|fuzzy&offset=N&limit=N with one page of the
+// keywords, across all services, that match
+func (ds *KeywordDatasource) handleResourceSearch(rw http.ResponseWriter, req *http.Request) {
+	params, err := url.ParseQuery(req.URL.RawQuery)
+	if err != nil {
+		writeError(rw, badRequest(err))
+		return
+	}
+
+	offset, err := intParam(params, "offset")
+	if err != nil {
+		writeError(rw, badRequest(err))
+		return
+	}
+	limit, err := intParam(params, "limit")
+	if err != nil {
+		writeError(rw, badRequest(err))
+		return
+	}
+
+	// Check the text and mode before reading the whole meta table
+	if _, err = searchKeywords(nil, params.Get("q"), params.Get("mode")); err != nil {
+		writeError(rw, badRequest(err))
+		return
+	}
+
+	cfg, db, err := openResourceDatabase(req)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	defer db.Close()
+
+	entries, err := loadSearchEntries(db, cfg)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+
+	results, err := searchKeywords(entries, params.Get("q"), params.Get("mode"))
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+
+	writeResult(rw, paginate(results, offset, limit))
+}
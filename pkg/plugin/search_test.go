@@ -0,0 +1,73 @@
+package plugin
+
+import "testing"
+
+func TestFuzzyScore(t *testing.T) {
+	if score, ok := fuzzyScore("tmp", "temp"); !ok || score != 0.75 {
+		t.Errorf("unexpected score %v (%v)", score, ok)
+	}
+	if score, ok := fuzzyScore("temp", "temp"); !ok || score != 1 {
+		t.Errorf("unexpected score %v (%v)", score, ok)
+	}
+	if _, ok := fuzzyScore("xyz", "temp"); ok {
+		t.Error("expected no match")
+	}
+}
+
+func TestSearchKeywords(t *testing.T) {
+	entries := []searchEntry{
+		{Service: "dcs", Keyword: "TEMP"},
+		{Service: "ao", Keyword: "WFSTEMP"},
+		{Service: "env", Keyword: "TEMPOUT"},
+		{Service: "met", Keyword: "TMPAIR"},
+		{Service: "dcs", Keyword: "FOCUS", Description: "Secondary temperature compensated focus"},
+	}
+
+	cases := []struct {
+		text     string
+		mode     string
+		expected []string
+	}{
+		{"temp", "", []string{"dcs.TEMP", "env.TEMPOUT", "ao.WFSTEMP", "dcs.FOCUS"}},
+		{"temp", SEARCH_MODE_PREFIX, []string{"dcs.TEMP", "env.TEMPOUT"}},
+		{"tmp", SEARCH_MODE_FUZZY, []string{"met.TMPAIR", "ao.WFSTEMP", "dcs.TEMP", "env.TEMPOUT"}},
+		{"dcs.f", "", []string{"dcs.FOCUS"}},
+	}
+
+	for _, c := range cases {
+		results, err := searchKeywords(entries, c.text, c.mode)
+		if err != nil {
+			t.Fatalf("%q %q: unexpected error %v", c.text, c.mode, err)
+		}
+		if len(results) != len(c.expected) {
+			t.Fatalf("%q %q: expected %d results, got %v", c.text, c.mode, len(c.expected), results)
+		}
+		for i, name := range c.expected {
+			if results[i].Service+"."+results[i].Keyword != name {
+				t.Errorf("%q %q: expected %s at %d, got %s.%s", c.text, c.mode, name, i, results[i].Service, results[i].Keyword)
+			}
+		}
+	}
+
+	if _, err := searchKeywords(entries, "temp", "regex"); err == nil {
+		t.Error("expected an error for an unknown mode")
+	}
+	if _, err := searchKeywords(entries, " ", ""); err == nil {
+		t.Error("expected an error for empty text")
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	results := make([]searchResult, 7)
+
+	page := paginate(results, 5, 3)
+	if page.Total != 7 || len(page.Results) != 2 {
+		t.Errorf("unexpected page %d of %d", len(page.Results), page.Total)
+	}
+	if page = paginate(results, 10, 3); len(page.Results) != 0 {
+		t.Error("expected an empty page past the end")
+	}
+	if page = paginate(results, 0, 0); page.Limit != SEARCH_DEFAULT_LIMIT || len(page.Results) != 7 {
+		t.Error("expected the default page size")
+	}
+}
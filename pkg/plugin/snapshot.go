@@ -0,0 +1,155 @@
+package plugin
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+	"github.com/lib/pq"
+)
+
+// snapshotRow is the latest sample of one keyword of a service as of some instant
+type snapshotRow struct {
+	keyword      string
+	keyword_type string
+	found        bool
+	time         time.Time
+	raw          sql.NullString
+}
+
+// parseInstant reads an instant given as RFC 3339 or as Unix seconds, an empty string gives the default
+func parseInstant(s string, def time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return def, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, nil
+	}
+	if u, err := strconv.ParseFloat(s, 64); err == nil {
+		return unixToTime(u), nil
+	}
+
+	return def, fmt.Errorf("invalid instant: %q, expected RFC 3339 or Unix seconds", s)
+}
+
+// loadSnapshot retrieves the latest sample at or before an instant for every keyword of a service in the meta table.
+// It's one statement per service: a lateral join probes the time index once per keyword, rather than a query per
+// keyword or a scan of the whole history.  Keywords never sampled before the instant come back with found unset.
+func loadSnapshot(db *sql.DB, config *DatasourceSettings, service string, at time.Time) ([]snapshotRow, error) {
+	sql_snapshot := fmt.Sprintf(`select m.keyword, m.type, s.time, s.binvalue from %s m
+		left join lateral (select d.time, trim(d.binvalue) as binvalue from %s d
+			where d.keyword = m.keyword and d.time <= $2 order by d.time desc limit 1) s on true
+		where m.service = $1 order by m.keyword asc;`, config.metaTable(), pq.QuoteIdentifier(service))
+
+	rows, err := db.Query(sql_snapshot, service, float64(at.UnixNano())*1e-9)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshot := []snapshotRow{}
+	for rows.Next() {
+		var row snapshotRow
+		var timetemp sql.NullFloat64
+		err = rows.Scan(&row.keyword, &row.keyword_type, &timetemp, &row.raw)
+		if err != nil {
+			return nil, err
+		}
+
+		if timetemp.Valid {
+			row.found = true
+			row.time = unixToTime(timetemp.Float64)
+		}
+		snapshot = append(snapshot, row)
+	}
+
+	return snapshot, rows.Err()
+}
+
+// numericValue reads a snapshot value as a number where the keyword type allows, booleans count as 0 and 1
+func (row snapshotRow) numericValue() *float64 {
+	if !row.found || row.keyword_type == "KTL_STRING" || isArrayType(row.keyword_type) {
+		return nil
+	}
+
+	if isBooleanType(row.keyword_type) {
+		b, err := parseBoolean(row.raw.String)
+		if err != nil {
+			return nil
+		}
+		v := 0.0
+		if b {
+			v = 1
+		}
+		return &v
+	}
+
+	v, ok := parseNumber(row.raw)
+	if !ok {
+		return nil
+	}
+	return &v
+}
+
+// querySnapshot builds a table with a row per keyword of a service: its latest value at or before the instant
+// (the end of the range unless the query gives one), the value as a number where it is one, the sample time and
+// the age of the sample at the instant
+func querySnapshot(db *sql.DB, config *DatasourceSettings, query backend.DataQuery, qm queryModel, service string) backend.DataResponse {
+	response := backend.DataResponse{}
+
+	at, err := parseInstant(qm.At, query.TimeRange.To)
+	if err != nil {
+		response.Error = err
+		return response
+	}
+
+	snapshot, err := loadSnapshot(db, config, service, at)
+	if err != nil {
+		log.DefaultLogger.Error(fl() + "snapshot retrieval error: " + err.Error())
+		response.Error = err
+		return response
+	}
+
+	keywords := make([]string, len(snapshot))
+	types := make([]string, len(snapshot))
+	values := make([]*string, len(snapshot))
+	numbers := make([]*float64, len(snapshot))
+	times := make([]*time.Time, len(snapshot))
+	ages := make([]*float64, len(snapshot))
+
+	for i, row := range snapshot {
+		keywords[i] = row.keyword
+		types[i] = row.keyword_type
+		numbers[i] = row.numericValue()
+
+		if row.found {
+			value := rawValue(row.raw)
+			values[i] = &value
+			sample_time := row.time
+			times[i] = &sample_time
+			age := at.Sub(row.time).Seconds()
+			ages[i] = &age
+		}
+	}
+
+	frame := data.NewFrame(service,
+		data.NewField("keyword", nil, keywords),
+		data.NewField("type", nil, types),
+		data.NewField("value", nil, values),
+		data.NewField("numeric value", nil, numbers),
+		data.NewField("time", nil, times),
+		data.NewField("age", nil, ages).SetConfig(&data.FieldConfig{Unit: "s"}),
+	)
+	frame.RefID = qm.RefId
+	setFrameType(frame, data.FrameTypeTable)
+
+	response.Frames = append(response.Frames, frame)
+	return response
+}
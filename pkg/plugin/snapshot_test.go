@@ -0,0 +1,48 @@
+package plugin
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestParseInstant(t *testing.T) {
+	def := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if at, err := parseInstant("", def); err != nil || !at.Equal(def) {
+		t.Errorf("expected the default for an empty instant")
+	}
+	if at, err := parseInstant("2024-03-05T13:12:45-10:00", def); err != nil || !at.Equal(time.Date(2024, 3, 5, 23, 12, 45, 0, time.UTC)) {
+		t.Errorf("unexpected RFC 3339 instant %s (%v)", at, err)
+	}
+	if at, err := parseInstant("1700000000.5", def); err != nil || at.UnixMilli() != 1700000000500 {
+		t.Errorf("unexpected Unix instant %s (%v)", at, err)
+	}
+	if _, err := parseInstant("yesterday", def); err == nil {
+		t.Error("expected an error for a bad instant")
+	}
+}
+
+func TestSnapshotNumericValue(t *testing.T) {
+	cases := []struct {
+		row      snapshotRow
+		expected *float64
+	}{
+		{snapshotRow{keyword_type: "KTL_DOUBLE", found: true, raw: sql.NullString{String: "1.5", Valid: true}}, ptr(1.5)},
+		{snapshotRow{keyword_type: "KTL_BOOLEAN", found: true, raw: sql.NullString{String: "true", Valid: true}}, ptr(1)},
+		{snapshotRow{keyword_type: "KTL_STRING", found: true, raw: sql.NullString{String: "1.5", Valid: true}}, nil},
+		{snapshotRow{keyword_type: "KTL_DOUBLE", found: false}, nil},
+		{snapshotRow{keyword_type: "KTL_DOUBLE", found: true, raw: sql.NullString{String: "junk", Valid: true}}, nil},
+	}
+
+	for i, c := range cases {
+		v := c.row.numericValue()
+		if (v == nil) != (c.expected == nil) || (v != nil && *v != *c.expected) {
+			t.Errorf("case %d: unexpected value %v", i, v)
+		}
+	}
+}
+
+func ptr(v float64) *float64 {
+	return &v
+}
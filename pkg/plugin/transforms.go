@@ -0,0 +1,194 @@
+package plugin
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// convertUnits applies one of the UNIT_CONVERT_* conversions to a single value
+func convertUnits(value float64, conversion int) (float64, error) {
+	switch conversion {
+
+	case UNIT_CONVERT_NONE:
+		// No conversion, just assign it straight over
+		return value, nil
+
+	case UNIT_CONVERT_DEG_TO_RAD:
+		// RAD = DEG * π/180  (1° = 0.01745rad)
+		return value * (math.Pi / 180), nil
+
+	case UNIT_CONVERT_RAD_TO_DEG:
+		// DEG = RAD * 180/π  (1rad = 57.296°)
+		return value * (180 / math.Pi), nil
+
+	case UNIT_CONVERT_RAD_TO_ARCSEC:
+		// ARCSEC = RAD * (3600 * 180)/π  (1rad = 206264.806")
+		return value * (3600 * 180 / math.Pi), nil
+
+	case UNIT_CONVERT_K_TO_C:
+		// °C = K + 273.15
+		return value + 273.15, nil
+
+	case UNIT_CONVERT_C_TO_K:
+		// K = °C − 273.15
+		return value - 273.15, nil
+
+	default:
+		return 0, fmt.Errorf("Unknown unit conversion: %d", conversion)
+	}
+}
+
+// anglePeriod returns a full turn in one of the ANGLE_UNITS_* units
+func anglePeriod(units int) (float64, error) {
+	switch units {
+	case ANGLE_UNITS_DEG:
+		return 360, nil
+	case ANGLE_UNITS_RAD:
+		return 2 * math.Pi, nil
+	default:
+		return 0, fmt.Errorf("Unknown angle units: %d", units)
+	}
+}
+
+// unwrapAngles removes the full turn discontinuities from a series of angles, the same as numpy unwrap()
+// does in Python: any step larger than half a turn is taken to be a wrap and is corrected by whole turns.
+// Unreadable values (NaN) stay NaN and each step is measured from the last readable value.
+func unwrapAngles(values []float64, period float64) []float64 {
+	unwrapped := make([]float64, len(values))
+
+	offset := 0.0
+	last := math.NaN()
+	for i, value := range values {
+		if !math.IsNaN(value) && !math.IsNaN(last) {
+			step := value - last
+			if math.Abs(step) > period/2 {
+				offset -= period * math.Round(step/period)
+			}
+		}
+		unwrapped[i] = value + offset
+		if !math.IsNaN(value) {
+			last = value
+		}
+	}
+
+	return unwrapped
+}
+
+// normalizeAngles maps every angle in a series into one of the WRAP_INTERVAL_* intervals
+func normalizeAngles(values []float64, period float64, interval int) ([]float64, error) {
+	var low float64
+	switch interval {
+	case WRAP_INTERVAL_POSITIVE:
+		low = 0
+	case WRAP_INTERVAL_SIGNED:
+		low = -period / 2
+	default:
+		return nil, fmt.Errorf("Unknown wrap interval: %d", interval)
+	}
+
+	normalized := make([]float64, len(values))
+	for i, v := range values {
+		v = math.Mod(v-low, period)
+		if v < 0 {
+			v += period
+		}
+		normalized[i] = v + low
+	}
+
+	return normalized, nil
+}
+
+// transformValues applies the query's TRANSFORM_* transform to a series.  The derivative and delta
+// transforms return one fewer element than they are given, the 0th time and value are dropped.
+func transformValues(times []time.Time, values []float64, qm queryModel) ([]time.Time, []float64, error) {
+	transform := qm.Transform
+
+	// Angular keywords can be unwrapped ahead of the difference based transforms so the rates come out right
+	if qm.UnwrapFirst && transform != TRANSFORM_NONE && transform != TRANSFORM_UNWRAP && transform != TRANSFORM_NORMALIZE {
+		period, err := anglePeriod(qm.AngleUnits)
+		if err != nil {
+			return times, values, err
+		}
+		values = unwrapAngles(values, period)
+	}
+
+	switch transform {
+
+	case TRANSFORM_NONE:
+		return times, values, nil
+
+	case TRANSFORM_FIRST_DERIVATVE, TRANSFORM_FIRST_DERIVATVE_1HZ, TRANSFORM_FIRST_DERIVATVE_10HZ, TRANSFORM_FIRST_DERIVATVE_100HZ:
+
+		// Nothing to difference with fewer than two samples
+		if len(values) < 2 {
+			return []time.Time{}, []float64{}, nil
+		}
+
+		// Compute the first derivative of the data.
+		dtimes := make([]time.Time, len(values)-1)
+		dvalues := make([]float64, len(values)-1)
+
+		for i := 1; i < len(values); i++ {
+			// Calculate the dt
+			dtimes[i-1] = times[i]
+
+			// Calculate the dy/dt
+			var dt, dvdt float64
+			dt = (times[i].Sub(times[i-1])).Seconds()
+			dvdt = (values[i] - values[i-1]) / dt
+
+			if transform == TRANSFORM_FIRST_DERIVATVE_1HZ {
+				dvdt = math.Round(dvdt)
+			} else if transform == TRANSFORM_FIRST_DERIVATVE_10HZ {
+				dvdt = math.Round(dvdt*10) / 10
+			} else if transform == TRANSFORM_FIRST_DERIVATVE_100HZ {
+				dvdt = math.Round(dvdt*100) / 100
+			}
+
+			dvalues[i-1] = dvdt
+		}
+
+		return dtimes, dvalues, nil
+
+	case TRANSFORM_DELTA:
+		// Compute the deltas of the data.  This algorithm replicates what numpy diff() does in Python,
+		// to the extent that it disregards the time series data.  The resultant arrays have one fewer element,
+		// we drop the 0th element of time and value.  It's like a first derivative where dt is always 1.
+		// See https://numpy.org/doc/stable/reference/generated/numpy.diff.html
+		if len(values) < 2 {
+			return []time.Time{}, []float64{}, nil
+		}
+
+		dtimes := make([]time.Time, len(values)-1)
+		dvalues := make([]float64, len(values)-1)
+
+		for i := 1; i < len(values); i++ {
+			// Bring the time val straight across, shifted by one
+			dtimes[i-1] = times[i]
+
+			// Calculate the dx/dt and assume dt is always 1
+			dvalues[i-1] = values[i] - values[i-1]
+		}
+
+		return dtimes, dvalues, nil
+
+	case TRANSFORM_UNWRAP:
+		period, err := anglePeriod(qm.AngleUnits)
+		if err != nil {
+			return times, values, err
+		}
+		return times, unwrapAngles(values, period), nil
+
+	case TRANSFORM_NORMALIZE:
+		period, err := anglePeriod(qm.AngleUnits)
+		if err != nil {
+			return times, values, err
+		}
+		normalized, err := normalizeAngles(values, period, qm.WrapInterval)
+		return times, normalized, err
+
+	default:
+		return times, values, fmt.Errorf("Unknown transform: %d", transform)
+	}
+}
@@ -0,0 +1,73 @@
+package plugin
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestUnwrapAngles(t *testing.T) {
+	values := unwrapAngles([]float64{350, 355, 5, 15, 355, 345}, 360)
+	expected := []float64{350, 355, 365, 375, 355, 345}
+	for i := range expected {
+		if math.Abs(values[i]-expected[i]) > 1e-9 {
+			t.Fatalf("expected %v, got %v", expected, values)
+		}
+	}
+
+	values = unwrapAngles([]float64{3.1, -3.1}, 2*math.Pi)
+	if math.Abs(values[1]-(2*math.Pi-3.1)) > 1e-9 {
+		t.Errorf("radian unwrap gave %v", values)
+	}
+
+	// A wrap across an unreadable value is measured from the last readable one
+	values = unwrapAngles([]float64{350, math.NaN(), 5, 10}, 360)
+	if !math.IsNaN(values[1]) || values[2] != 365 || values[3] != 370 {
+		t.Errorf("unwrap across a NaN gave %v", values)
+	}
+}
+
+func TestNormalizeAngles(t *testing.T) {
+	values, err := normalizeAngles([]float64{-10, 370, 180, 720}, 360, WRAP_INTERVAL_POSITIVE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []float64{350, 10, 180, 0}
+	for i := range expected {
+		if math.Abs(values[i]-expected[i]) > 1e-9 {
+			t.Fatalf("expected %v, got %v", expected, values)
+		}
+	}
+
+	values, _ = normalizeAngles([]float64{190, -190, 180}, 360, WRAP_INTERVAL_SIGNED)
+	expected = []float64{-170, 170, -180}
+	for i := range expected {
+		if math.Abs(values[i]-expected[i]) > 1e-9 {
+			t.Fatalf("expected %v, got %v", expected, values)
+		}
+	}
+}
+
+func TestTransformUnwrapFirst(t *testing.T) {
+	now := time.Now()
+	times := []time.Time{now, now.Add(time.Second), now.Add(2 * time.Second)}
+	values := []float64{358, 0, 2}
+
+	_, rates, err := transformValues(times, values, queryModel{Transform: TRANSFORM_FIRST_DERIVATVE})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rates[0] != -358 {
+		t.Errorf("expected the wrap to show without unwrapping, got %v", rates)
+	}
+
+	_, rates, _ = transformValues(times, values, queryModel{Transform: TRANSFORM_FIRST_DERIVATVE, UnwrapFirst: true})
+	if rates[0] != 2 || rates[1] != 2 {
+		t.Errorf("expected a steady 2 deg/s, got %v", rates)
+	}
+
+	dtimes, _, _ := transformValues(times[:1], values[:1], queryModel{Transform: TRANSFORM_DELTA})
+	if len(dtimes) != 0 {
+		t.Errorf("expected no deltas from a single sample")
+	}
+}
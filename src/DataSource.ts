@@ -1,21 +1,34 @@
 import { DataSourceInstanceSettings, SelectableValue } from '@grafana/data';
 import { DataSourceWithBackend } from '@grafana/runtime';
-import { KeywordDataSourceOptions, KeywordQuery } from './types';
+import { KeywordDataSourceOptions, KeywordMetadata, KeywordQuery, KeywordSearchPage } from './types';
 
 export class DataSource extends DataSourceWithBackend<KeywordQuery, KeywordDataSourceOptions> {
   constructor(instanceSettings: DataSourceInstanceSettings<KeywordDataSourceOptions>) {
     super(instanceSettings);
+
+    // Keyword transitions can be used as annotations, the query editor is shared with panel queries
+    this.annotations = {};
   }
 
   async getServices(): Promise<Array<SelectableValue<string>>> {
-    return this.getResource('services').then(({ services }) =>
-      services ? Object.entries(services).map(([value, label]) => ({ label, value } as SelectableValue<string>)) : []
-    );
+    return this.getResource('services').then(({ data }) => (data as Array<SelectableValue<string>>) ?? []);
   }
 
   async getKeywords(service: string): Promise<Array<SelectableValue<string>>> {
-    return this.getResource('keywords', { service: service }).then(({ keywords }) =>
-      keywords ? Object.entries(keywords).map(([value, label]) => ({ label, value } as SelectableValue<string>)) : []
+    // A service is required, there's nothing to list until one is picked
+    if (!service) {
+      return [];
+    }
+    return this.getResource('keywords', { service: service }).then(
+      ({ data }) => (data as Array<SelectableValue<string>>) ?? []
     );
   }
+
+  async getKeyword(service: string, keyword: string): Promise<KeywordMetadata | undefined> {
+    return this.getResource('keyword', { service: service, keyword: keyword }).then(({ data }) => data);
+  }
+
+  async searchKeywords(text: string, mode = 'substring', offset = 0, limit = 50): Promise<KeywordSearchPage | undefined> {
+    return this.getResource('search', { q: text, mode: mode, offset: offset, limit: limit }).then(({ data }) => data);
+  }
 }
@@ -55,6 +55,42 @@ export class ConfigEditor extends PureComponent<Props, State> {
     onOptionsChange({ ...options, jsonData });
   };
 
+  onEnumtableChange = (event: ChangeEvent<HTMLInputElement>) => {
+    const { onOptionsChange, options } = this.props;
+    const jsonData = {
+      ...options.jsonData,
+      enumtable: event.target.value,
+    };
+    onOptionsChange({ ...options, jsonData });
+  };
+
+  onChangeservicesChange = (event: ChangeEvent<HTMLInputElement>) => {
+    const { onOptionsChange, options } = this.props;
+    const jsonData = {
+      ...options.jsonData,
+      changeservices: event.target.value,
+    };
+    onOptionsChange({ ...options, jsonData });
+  };
+
+  onLatitudeChange = (event: ChangeEvent<HTMLInputElement>) => {
+    const { onOptionsChange, options } = this.props;
+    const jsonData = {
+      ...options.jsonData,
+      latitude: event.target.value,
+    };
+    onOptionsChange({ ...options, jsonData });
+  };
+
+  onLongitudeChange = (event: ChangeEvent<HTMLInputElement>) => {
+    const { onOptionsChange, options } = this.props;
+    const jsonData = {
+      ...options.jsonData,
+      longitude: event.target.value,
+    };
+    onOptionsChange({ ...options, jsonData });
+  };
+
   render() {
     const { options } = this.props;
     const { jsonData } = options;
@@ -109,6 +145,50 @@ export class ConfigEditor extends PureComponent<Props, State> {
             placeholder="ktlmeta"
           />
         </div>
+        <div className="gf-form">
+          <FormField
+            label="Enum table"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onEnumtableChange}
+            value={jsonData.enumtable || ''}
+            placeholder="(meta table enumerators)"
+            tooltip="Optional table of service, keyword, value, label rows for enumerated keywords"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Change services"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onChangeservicesChange}
+            value={jsonData.changeservices || ''}
+            placeholder="(all services)"
+            tooltip="Services scanned for what changed around an instant, comma separated names or patterns such as dcs*"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Site latitude"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onLatitudeChange}
+            value={jsonData.latitude || ''}
+            placeholder="19.8260"
+            tooltip="Degrees north, used by the computed ephem service"
+          />
+        </div>
+        <div className="gf-form">
+          <FormField
+            label="Site longitude"
+            labelWidth={10}
+            inputWidth={20}
+            onChange={this.onLongitudeChange}
+            value={jsonData.longitude || ''}
+            placeholder="-155.4747"
+            tooltip="Degrees east, used by the computed ephem service"
+          />
+        </div>
       </div>
     );
   }
@@ -1,7 +1,7 @@
 import defaults from 'lodash/defaults';
 
 import React, { PureComponent } from 'react';
-import { InlineFormLabel, SegmentAsync, Select } from '@grafana/ui';
+import { InlineFormLabel, InlineSwitch, Input, SegmentAsync, Select } from '@grafana/ui';
 import { QueryEditorProps } from '@grafana/data';
 import { DataSource } from '../DataSource';
 import { defaultQuery, KeywordDataSourceOptions, KeywordQuery } from '../types';
@@ -10,9 +10,15 @@ type Props = QueryEditorProps<DataSource, KeywordQuery, KeywordDataSourceOptions
 
 export class QueryEditor extends PureComponent<Props> {
   onServiceChange = (item: any) => {
-    const { onChange, query } = this.props;
+    const { onChange, onRunQuery, query } = this.props;
     // Repopulate the keyword list based on the service selected
-    onChange({ ...query, service: item.value });
+    const queryText = item.value + '.' + (query.keyword ?? '');
+    onChange({ ...query, service: item.value, queryText });
+
+    // Snapshots, diffs and change searches only need the service, the other modes wait for a keyword of the new service
+    if (query.mode === 5 || query.mode === 6 || query.mode === 7) {
+      onRunQuery();
+    }
   };
 
   onKeywordChange = (item: any) => {
@@ -28,6 +34,93 @@ export class QueryEditor extends PureComponent<Props> {
     onRunQuery();
   };
 
+  modeOptions = [
+    { label: 'Time series', value: 0 },
+    { label: 'Transitions as annotations', value: 1 },
+    { label: 'Threshold events', value: 2 },
+    { label: 'Duration in each state', value: 3 },
+    { label: 'Latest value', value: 4 },
+    { label: 'Service snapshot', value: 5 },
+    { label: 'Snapshot diff', value: 6 },
+    { label: 'What changed around a time', value: 7 },
+    { label: 'Data availability', value: 8 },
+  ];
+
+  onModeChange = (item: any) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, mode: item.value });
+    onRunQuery();
+  };
+
+  onAnnotationValuesChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const { onChange, query } = this.props;
+    onChange({ ...query, annotationValues: event.target.value });
+  };
+
+  conditionOptions = [
+    { label: '>', value: 0 },
+    { label: '<', value: 1 },
+    { label: 'inside range', value: 2 },
+    { label: 'outside range', value: 3 },
+  ];
+
+  onConditionChange = (item: any) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, condition: item.value });
+    onRunQuery();
+  };
+
+  rankOptions = [
+    { label: 'most changes', value: 0 },
+    { label: 'closest to the time', value: 1 },
+  ];
+
+  onRankChange = (item: any) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, rank: item.value });
+    onRunQuery();
+  };
+
+  bucketOptions = [
+    { label: 'per hour', value: 'hour' },
+    { label: 'per day (site local time)', value: 'day' },
+    { label: 'per night (local noon to noon)', value: 'night' },
+  ];
+
+  onBucketChange = (item: any) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, bucket: item.value });
+    onRunQuery();
+  };
+
+  onNumberChange = (key: keyof KeywordQuery) => (event: React.ChangeEvent<HTMLInputElement>) => {
+    const { onChange, query } = this.props;
+    onChange({ ...query, [key]: parseFloat(event.target.value) });
+  };
+
+  onAtChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const { onChange, query } = this.props;
+    onChange({ ...query, at: event.target.value });
+  };
+
+  onCompareChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const { onChange, query } = this.props;
+    onChange({ ...query, compare: event.target.value });
+  };
+
+  formatOptions = [
+    { label: 'Time series', value: 'time_series' },
+    { label: 'Table', value: 'table' },
+    { label: 'Wide table', value: 'wide' },
+    { label: 'Logs', value: 'logs' },
+  ];
+
+  onFormatChange = (item: any) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, format: item.value });
+    onRunQuery();
+  };
+
   unitConversionOptions = [
     { label: '(none)', value: 0 },
     { label: 'degrees to radians', value: 1 },
@@ -50,6 +143,8 @@ export class QueryEditor extends PureComponent<Props> {
     { label: '1st derivative (10Hz rounding)', value: 3 },
     { label: '1st derivative (100Hz rounding)', value: 4 },
     { label: 'delta', value: 5 },
+    { label: 'unwrap angle', value: 6 },
+    { label: 'normalize angle', value: 7 },
   ];
 
   onTransformChange = (item: any) => {
@@ -58,6 +153,117 @@ export class QueryEditor extends PureComponent<Props> {
     onRunQuery();
   };
 
+  angleUnitOptions = [
+    { label: 'degrees', value: 0 },
+    { label: 'radians', value: 1 },
+  ];
+
+  onAngleUnitsChange = (item: any) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, angleUnits: item.value });
+    onRunQuery();
+  };
+
+  wrapIntervalOptions = [
+    { label: '[0, 360°) / [0, 2π)', value: 0 },
+    { label: '[-180°, 180°) / [-π, π)', value: 1 },
+  ];
+
+  onWrapIntervalChange = (item: any) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, wrapInterval: item.value });
+    onRunQuery();
+  };
+
+  onUnwrapFirstChange = (event: React.FormEvent<HTMLInputElement>) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, unwrapFirst: event.currentTarget.checked });
+    onRunQuery();
+  };
+
+  onEnumTextChange = (event: React.FormEvent<HTMLInputElement>) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, enumText: event.currentTarget.checked });
+    onRunQuery();
+  };
+
+  onDecodeBitsChange = (event: React.FormEvent<HTMLInputElement>) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, decodeBits: event.currentTarget.checked });
+    onRunQuery();
+  };
+
+  onBitsChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const { onChange, query } = this.props;
+    onChange({ ...query, bits: event.target.value });
+  };
+
+  onElementsChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const { onChange, query } = this.props;
+    onChange({ ...query, elements: event.target.value });
+  };
+
+  onArrayHeatmapChange = (event: React.FormEvent<HTMLInputElement>) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, arrayHeatmap: event.currentTarget.checked });
+    onRunQuery();
+  };
+
+  onTrueDurationChange = (event: React.FormEvent<HTMLInputElement>) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, trueDuration: event.currentTarget.checked });
+    onRunQuery();
+  };
+
+  badRowOptions = [
+    { label: 'null', value: 0 },
+    { label: 'skip', value: 1 },
+  ];
+
+  onBadRowsChange = (item: any) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, badRows: item.value });
+    onRunQuery();
+  };
+
+  onMaxBadRatioChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const { onChange, query } = this.props;
+    // Cleared means the default limit, zero means no unreadable rows at all
+    const ratio = parseFloat(event.target.value);
+    onChange({ ...query, maxBadRatio: isNaN(ratio) ? undefined : ratio });
+  };
+
+  onDedupeChange = (event: React.FormEvent<HTMLInputElement>) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, dedupe: event.currentTarget.checked });
+    onRunQuery();
+  };
+
+  onDedupeToleranceChange = (event: React.ChangeEvent<HTMLInputElement>) => {
+    const { onChange, query } = this.props;
+    onChange({ ...query, dedupeTolerance: parseFloat(event.target.value) });
+  };
+
+  onDedupeKeepLastChange = (event: React.FormEvent<HTMLInputElement>) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, dedupeKeepLast: event.currentTarget.checked });
+    onRunQuery();
+  };
+
+  parseOptions = [
+    { label: '(none)', value: 0 },
+    { label: 'sexagesimal hours to degrees', value: 1 },
+    { label: 'sexagesimal hours to radians', value: 2 },
+    { label: 'sexagesimal degrees to degrees', value: 3 },
+    { label: 'sexagesimal degrees to radians', value: 4 },
+  ];
+
+  onParseChange = (item: any) => {
+    const { onChange, query, onRunQuery } = this.props;
+    onChange({ ...query, parse: item.value });
+    onRunQuery();
+  };
+
   render() {
     const datasource = this.props.datasource;
     const query = defaults(this.props.query, defaultQuery);
@@ -73,7 +279,7 @@ export class QueryEditor extends PureComponent<Props> {
             loadOptions={() => datasource.getServices()}
             placeholder="(select a service)"
             value={query.service}
-            allowCustomValue={false}
+            allowCustomValue={query.mode === 6 || query.mode === 7}
             onChange={this.onServiceChange}
           ></SegmentAsync>
           <SegmentAsync
@@ -84,6 +290,173 @@ export class QueryEditor extends PureComponent<Props> {
             onChange={this.onKeywordChange}
           ></SegmentAsync>
         </div>
+        <div className="gf-form-inline">
+          <InlineFormLabel width={10} className="mode" tooltip={<p>What to compute from the keyword.</p>}>
+            Mode
+          </InlineFormLabel>
+          <Select
+            width={30}
+            defaultValue={0}
+            options={this.modeOptions}
+            value={query.mode}
+            allowCustomValue={false}
+            onChange={this.onModeChange}
+          />
+          {query.mode === 5 && (
+            <Input
+              width={30}
+              placeholder="(end of range, or RFC 3339 / Unix time)"
+              value={query.at}
+              onChange={this.onAtChange}
+              onBlur={() => this.props.onRunQuery()}
+            />
+          )}
+          {query.mode === 6 && (
+            <>
+              <Input
+                width={30}
+                placeholder="(start of range, or RFC 3339 / Unix time)"
+                value={query.at}
+                onChange={this.onAtChange}
+                onBlur={() => this.props.onRunQuery()}
+              />
+              <Input
+                width={30}
+                placeholder="(end of range, or RFC 3339 / Unix time)"
+                value={query.compare}
+                onChange={this.onCompareChange}
+                onBlur={() => this.props.onRunQuery()}
+              />
+            </>
+          )}
+          {query.mode === 8 && (
+            <Select
+              width={30}
+              defaultValue={'hour'}
+              options={this.bucketOptions}
+              value={query.bucket}
+              allowCustomValue={false}
+              onChange={this.onBucketChange}
+            />
+          )}
+          {query.mode === 1 && (
+            <Input
+              width={30}
+              placeholder="(all values, or e.g. Open,Closed)"
+              value={query.annotationValues}
+              onChange={this.onAnnotationValuesChange}
+              onBlur={() => this.props.onRunQuery()}
+            />
+          )}
+        </div>
+        {query.mode === 7 && (
+          <div className="gf-form-inline">
+            <InlineFormLabel
+              width={10}
+              className="changes"
+              tooltip={<p>Time (middle of range by default), ± window (s), ranking and the most keywords to list.</p>}
+            >
+              Around
+            </InlineFormLabel>
+            <Input
+              width={30}
+              placeholder="(middle of range, or RFC 3339 / Unix time)"
+              value={query.at}
+              onChange={this.onAtChange}
+              onBlur={() => this.props.onRunQuery()}
+            />
+            <Input
+              width={10}
+              type="number"
+              value={query.window}
+              onChange={this.onNumberChange('window')}
+              onBlur={() => this.props.onRunQuery()}
+            />
+            <Select
+              width={24}
+              defaultValue={0}
+              options={this.rankOptions}
+              value={query.rank}
+              allowCustomValue={false}
+              onChange={this.onRankChange}
+            />
+            <Input
+              width={10}
+              type="number"
+              value={query.limit}
+              onChange={this.onNumberChange('limit')}
+              onBlur={() => this.props.onRunQuery()}
+            />
+          </div>
+        )}
+        {query.mode === 2 && (
+          <div className="gf-form-inline">
+            <InlineFormLabel
+              width={10}
+              className="condition"
+              tooltip={<p>Condition, threshold (and upper threshold for ranges), hysteresis and minimum duration (s).</p>}
+            >
+              Condition
+            </InlineFormLabel>
+            <Select
+              width={16}
+              defaultValue={0}
+              options={this.conditionOptions}
+              value={query.condition}
+              allowCustomValue={false}
+              onChange={this.onConditionChange}
+            />
+            <Input
+              width={10}
+              type="number"
+              placeholder="threshold"
+              value={query.threshold}
+              onChange={this.onNumberChange('threshold')}
+              onBlur={() => this.props.onRunQuery()}
+            />
+            {query.condition >= 2 && (
+              <Input
+                width={10}
+                type="number"
+                placeholder="upper"
+                value={query.thresholdHigh}
+                onChange={this.onNumberChange('thresholdHigh')}
+                onBlur={() => this.props.onRunQuery()}
+              />
+            )}
+            <Input
+              width={10}
+              type="number"
+              min={0}
+              placeholder="hysteresis"
+              value={query.hysteresis}
+              onChange={this.onNumberChange('hysteresis')}
+              onBlur={() => this.props.onRunQuery()}
+            />
+            <Input
+              width={10}
+              type="number"
+              min={0}
+              placeholder="min s"
+              value={query.minDuration}
+              onChange={this.onNumberChange('minDuration')}
+              onBlur={() => this.props.onRunQuery()}
+            />
+          </div>
+        )}
+        <div className="gf-form-inline">
+          <InlineFormLabel width={10} className="format" tooltip={<p>Shape of the response.</p>}>
+            Format
+          </InlineFormLabel>
+          <Select
+            width={30}
+            defaultValue={'time_series'}
+            options={this.formatOptions}
+            value={query.format}
+            allowCustomValue={false}
+            onChange={this.onFormatChange}
+          />
+        </div>
         <div className="gf-form-inline">
           <InlineFormLabel width={10} className="convert-units" tooltip={<p>Convert units.</p>}>
             Units conversion
@@ -111,6 +484,136 @@ export class QueryEditor extends PureComponent<Props> {
             allowCustomValue={false}
             onChange={this.onTransformChange}
           />
+          <InlineFormLabel width={6} className="angle-units" tooltip={<p>Units of angular values for unwrap and normalize.</p>}>
+            Angles
+          </InlineFormLabel>
+          <Select
+            width={12}
+            defaultValue={0}
+            options={this.angleUnitOptions}
+            value={query.angleUnits}
+            allowCustomValue={false}
+            onChange={this.onAngleUnitsChange}
+          />
+          <Select
+            width={24}
+            defaultValue={0}
+            options={this.wrapIntervalOptions}
+            value={query.wrapInterval}
+            allowCustomValue={false}
+            onChange={this.onWrapIntervalChange}
+          />
+          <InlineSwitch
+            label="Unwrap first"
+            showLabel={true}
+            value={query.unwrapFirst}
+            onChange={this.onUnwrapFirstChange}
+          />
+        </div>
+        <div className="gf-form-inline">
+          <InlineFormLabel width={10} className="parse" tooltip={<p>Parse string values into angles.</p>}>
+            String parsing
+          </InlineFormLabel>
+          <Select
+            width={30}
+            placeholder={'(none)'}
+            defaultValue={0}
+            options={this.parseOptions}
+            value={query.parse}
+            allowCustomValue={false}
+            onChange={this.onParseChange}
+          />
+          <InlineSwitch
+            label="Enum labels"
+            showLabel={true}
+            value={query.enumText}
+            onChange={this.onEnumTextChange}
+          />
+          <InlineSwitch
+            label="Boolean true duration"
+            showLabel={true}
+            value={query.trueDuration}
+            onChange={this.onTrueDurationChange}
+          />
+        </div>
+        <div className="gf-form-inline">
+          <InlineFormLabel
+            width={10}
+            className="bad-rows"
+            tooltip={<p>What to do with values that can&apos;t be read, and the fraction at which the query fails.</p>}
+          >
+            Unreadable rows
+          </InlineFormLabel>
+          <Select
+            width={12}
+            defaultValue={0}
+            options={this.badRowOptions}
+            value={query.badRows}
+            allowCustomValue={false}
+            onChange={this.onBadRowsChange}
+          />
+          <Input
+            width={10}
+            type="number"
+            min={0}
+            max={1}
+            step={0.05}
+            value={query.maxBadRatio ?? ''}
+            onChange={this.onMaxBadRatioChange}
+            onBlur={() => this.props.onRunQuery()}
+          />
+        </div>
+        <div className="gf-form-inline">
+          <InlineFormLabel width={10} className="dedupe" tooltip={<p>Keep only samples that differ from the previous one.</p>}>
+            Changes only
+          </InlineFormLabel>
+          <InlineSwitch value={query.dedupe} onChange={this.onDedupeChange} />
+          <Input
+            width={10}
+            type="number"
+            min={0}
+            placeholder="tolerance"
+            value={query.dedupeTolerance}
+            onChange={this.onDedupeToleranceChange}
+            onBlur={() => this.props.onRunQuery()}
+          />
+          <InlineSwitch
+            label="Keep final sample"
+            showLabel={true}
+            value={query.dedupeKeepLast}
+            onChange={this.onDedupeKeepLastChange}
+          />
+        </div>
+        <div className="gf-form-inline">
+          <InlineFormLabel width={10} className="bitmask" tooltip={<p>Split a mask keyword into one series per bit.</p>}>
+            Bit decoding
+          </InlineFormLabel>
+          <InlineSwitch value={query.decodeBits} onChange={this.onDecodeBitsChange} />
+          <Input
+            width={20}
+            placeholder="(all bits, e.g. 0,3,5-7)"
+            value={query.bits}
+            onChange={this.onBitsChange}
+            onBlur={() => this.props.onRunQuery()}
+          />
+        </div>
+        <div className="gf-form-inline">
+          <InlineFormLabel width={10} className="array" tooltip={<p>Select elements of an array keyword.</p>}>
+            Array elements
+          </InlineFormLabel>
+          <Input
+            width={20}
+            placeholder="(all, e.g. 0-35)"
+            value={query.elements}
+            onChange={this.onElementsChange}
+            onBlur={() => this.props.onRunQuery()}
+          />
+          <InlineSwitch
+            label="Heatmap"
+            showLabel={true}
+            value={query.arrayHeatmap}
+            onChange={this.onArrayHeatmapChange}
+          />
         </div>
       </>
     );
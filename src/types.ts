@@ -3,15 +3,73 @@ import { DataQuery } from '@grafana/schema';
 
 export interface KeywordQuery extends DataQuery {
   queryText: string;
+  format: string;
+  mode: number;
   service: string;
   keyword: string;
   unitConversion: number;
   transform: number;
+  parse: number;
+  angleUnits: number;
+  wrapInterval: number;
+  unwrapFirst: boolean;
+  enumText: boolean;
+  decodeBits: boolean;
+  bits: string;
+  elements: string;
+  arrayHeatmap: boolean;
+  trueDuration: boolean;
+  badRows: number;
+  maxBadRatio?: number;
+  dedupe: boolean;
+  dedupeTolerance: number;
+  dedupeKeepLast: boolean;
+  annotationValues: string;
+  condition: number;
+  threshold: number;
+  thresholdHigh: number;
+  hysteresis: number;
+  minDuration: number;
+  at: string;
+  compare: string;
+  window: number;
+  rank: number;
+  limit: number;
+  bucket: string;
 }
 
 export const defaultQuery: Partial<KeywordQuery> = {
+  format: 'time_series',
+  mode: 0,
   unitConversion: 0,
   transform: 0,
+  parse: 0,
+  angleUnits: 0,
+  wrapInterval: 0,
+  unwrapFirst: false,
+  enumText: false,
+  decodeBits: false,
+  bits: '',
+  elements: '',
+  arrayHeatmap: false,
+  trueDuration: false,
+  badRows: 0,
+  maxBadRatio: 0.5,
+  dedupe: false,
+  dedupeTolerance: 0,
+  dedupeKeepLast: true,
+  annotationValues: '',
+  condition: 0,
+  threshold: 0,
+  thresholdHigh: 0,
+  hysteresis: 0,
+  minDuration: 0,
+  at: '',
+  compare: '',
+  window: 60,
+  rank: 0,
+  limit: 100,
+  bucket: 'hour',
 };
 
 /**
@@ -23,4 +81,35 @@ export interface KeywordDataSourceOptions extends DataSourceJsonData {
   role: string;
   database: string;
   metatable: string;
+  enumtable: string;
+  changeservices: string;
+  latitude: string;
+  longitude: string;
+}
+
+/**
+ * Everything known about one keyword, as returned by the /keyword resource
+ */
+export interface KeywordMetadata {
+  service: string;
+  keyword: string;
+  type: string;
+  units: string;
+  description: string;
+  enumerators: Array<{ value: number; label: string }>;
+  limits: { min: number | null; max: number | null };
+  first: string | null;
+  last: string | null;
+  count: number;
+  computed: boolean;
+}
+
+/**
+ * One page of keyword search results, as returned by the /search resource
+ */
+export interface KeywordSearchPage {
+  results: Array<{ service: string; keyword: string; type: string; description: string; score: number }>;
+  total: number;
+  offset: number;
+  limit: number;
 }